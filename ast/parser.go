@@ -4,6 +4,8 @@ import (
 	"errors"
 	d "example/compilers/domain"
 	"fmt"
+	"io"
+	"strings"
 )
 
 const (
@@ -16,45 +18,154 @@ type ErrParse struct {
 }
 
 func (e ErrParse) Error() string {
-	return fmt.Sprintf("%s %s", e.message, e.token)
+	return fmt.Sprintf("%s: %s (%s)", d.SpanOf(e.token).Start, e.message, e.token.Where())
+}
+
+func (e ErrParse) Message() string {
+	return e.message
+}
+
+func (e ErrParse) Span() d.Span {
+	return d.SpanOf(e.token)
+}
+
+// ErrSyntax collects every ErrParse found while parsing a program.
+type ErrSyntax struct {
+	errs []error
+}
+
+func (e ErrSyntax) Error() string {
+	var sb strings.Builder
+	sb.WriteString("syntax error(s):")
+	for _, e := range e.errs {
+		sb.WriteString("\n")
+		sb.WriteString(e.Error())
+	}
+
+	return sb.String()
+}
+
+func (e ErrSyntax) Unwrap() []error {
+	return e.errs
+}
+
+// TokenSource supplies tokens to the parser one at a time, like
+// lex.Scanner. Next returns an EOF token, or nil, once the tokens run out.
+type TokenSource interface {
+	Next() (*d.Token, error)
+}
+
+type sliceSource struct {
+	tokens  []*d.Token
+	current int
+}
+
+func (s *sliceSource) Next() (*d.Token, error) {
+	if s.current >= len(s.tokens) {
+		return nil, nil
+	}
+	s.current++
+	return s.tokens[s.current-1], nil
 }
 
 type Parser struct {
+	source    TokenSource
+	exhausted bool
+
+	// Tokens pulled from the source, trimmed between top-level declarations
 	tokens  []*d.Token
 	current int
+
+	errs       []error
+	blockDepth int
 }
 
 func NewParser(tokens []*d.Token) *Parser {
+	return NewSourceParser(&sliceSource{tokens: tokens})
+}
+
+// NewSourceParser parses tokens as they are pulled from source, so lexing
+// and parsing can proceed together.
+func NewSourceParser(source TokenSource) *Parser {
 	return &Parser{
-		tokens:  tokens,
+		source:  source,
+		tokens:  make([]*d.Token, 0),
 		current: 0,
 	}
 }
 
+// Parse parses the whole program, recovering from syntax errors so that all
+// of them are reported at once. The statements that did parse are returned
+// alongside any ErrSyntax.
 func (p *Parser) Parse() ([]d.Stmt, error) {
 	statements := make([]d.Stmt, 0)
-	for !p.isAtEnd() {
-		st, err := p.parseDeclaration()
-		if err != nil {
+	for {
+		st, err := p.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var errSyntax ErrSyntax
+		if err != nil && !errors.As(err, &errSyntax) {
 			return nil, err
 		}
-		statements = append(statements, st)
+		if st != nil {
+			statements = append(statements, st)
+		}
+	}
+
+	if len(p.errs) != 0 {
+		return statements, ErrSyntax{errs: p.errs}
 	}
 
 	return statements, nil
 }
 
+// Next parses the next top-level declaration, returning io.EOF once there
+// are none left. Errors in the declaration are returned as an ErrSyntax,
+// along with the statement if it could still be parsed. Parsing can carry on
+// after an ErrSyntax.
+func (p *Parser) Next() (d.Stmt, error) {
+	errStart := len(p.errs)
+	if p.isAtEnd() {
+		if len(p.errs) > errStart {
+			return nil, ErrSyntax{errs: p.errs[errStart:]}
+		}
+		return nil, io.EOF
+	}
+
+	p.trim()
+	st, err := p.parseDeclaration()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.errs) > errStart {
+		return st, ErrSyntax{errs: p.errs[errStart:]}
+	}
+	return st, nil
+}
+
+// trim drops consumed tokens, apart from the previous one.
+func (p *Parser) trim() {
+	if p.current <= 1 {
+		return
+	}
+	p.tokens = append([]*d.Token(nil), p.tokens[p.current-1:]...)
+	p.current = 1
+}
+
 func (p *Parser) parseDeclaration() (d.Stmt, error) {
 	pFunc := p.parseStatement
 	if p.match(d.CLASS) {
-		return p.parseClassDeclaration()
-	}
-	if p.match(d.FUN) {
+		pFunc = p.parseClassDeclaration
+	} else if p.check(d.FUN) && p.checkAt(1, d.IDENTIFIER) {
+		// Without a name it's an anonymous function expression
+		p.advance()
 		pFunc = func() (d.Stmt, error) {
 			return p.parseFunction("function")()
 		}
-	}
-	if p.match(d.VAR) {
+	} else if p.match(d.VAR) {
 		pFunc = p.parseVarDeclaration
 	}
 
@@ -63,15 +174,22 @@ func (p *Parser) parseDeclaration() (d.Stmt, error) {
 		return s, nil
 	}
 
-	if !errors.Is(err, ErrParse{}) {
+	var errParse ErrParse
+	if !errors.As(err, &errParse) {
 		return s, err
 	}
 
+	// Record the error and skip to the next statement, the caller drops the
+	// missing declaration
+	if errParse.token == nil || errParse.token.Kind != d.ERROR {
+		p.errs = append(p.errs, err)
+	}
 	p.sync()
 	return nil, nil
 }
 
 func (p *Parser) parseClassDeclaration() (d.Stmt, error) {
+	keyword := p.previous()
 	name, err := p.consume(d.IDENTIFIER, "Expect class name")
 	if err != nil {
 		return nil, err
@@ -85,6 +203,7 @@ func (p *Parser) parseClassDeclaration() (d.Stmt, error) {
 		}
 		superclass = &d.VariableExpr{
 			Name: p.previous(),
+			Span: p.previous().Span,
 		}
 	}
 
@@ -112,12 +231,19 @@ func (p *Parser) parseClassDeclaration() (d.Stmt, error) {
 		Name:       name,
 		SuperClass: superclass,
 		Methods:    methods,
+		Span:       p.spanFrom(keyword),
 	}, nil
 }
 
 func (p *Parser) parseFunction(kind string) func() (d.FunctionStmt, error) {
 	nilFn := d.FunctionStmt{}
 	return func() (d.FunctionStmt, error) {
+		// Functions start at the 'fun' keyword, methods at their name
+		start := p.peek()
+		if kind == "function" {
+			start = p.previous()
+		}
+
 		name, err := p.consume(d.IDENTIFIER, fmt.Sprintf("Expect %s name.", kind))
 		if err != nil {
 			return nilFn, err
@@ -128,31 +254,7 @@ func (p *Parser) parseFunction(kind string) func() (d.FunctionStmt, error) {
 			return nilFn, err
 		}
 
-		params := make([]*d.Token, 0)
-		if !p.check(d.RIGHT_PAREN) {
-			paramV, err := p.consume(d.IDENTIFIER, "Expect parameter name")
-			if err != nil {
-				return nilFn, err
-			}
-			params = append(params, paramV)
-
-			for p.match(d.COMMA) {
-				if len(params) >= maxArgsSize {
-					return nilFn, ErrParse{
-						message: fmt.Sprintf("Can't have more than %d params.", maxArgsSize),
-						token:   p.peek(),
-					}
-				}
-
-				paramV, err := p.consume(d.IDENTIFIER, "Expect parameter name")
-				if err != nil {
-					return nilFn, err
-				}
-				params = append(params, paramV)
-			}
-		}
-
-		_, err = p.consume(d.RIGHT_PAREN, "Expect ')' after paramters.")
+		params, err := p.parseParams()
 		if err != nil {
 			return nilFn, err
 		}
@@ -168,14 +270,89 @@ func (p *Parser) parseFunction(kind string) func() (d.FunctionStmt, error) {
 		}
 
 		return d.FunctionStmt{
-			Name:   name,
-			Params: params,
-			Body:   body,
+			Name:     name,
+			Params:   params.params,
+			Defaults: params.defaults,
+			Rest:     params.rest,
+			Body:     body,
+			Span:     p.spanFrom(start),
 		}, nil
 	}
 }
 
+// paramList is a parsed parameter list. Defaults has an entry for each
+// param, nil for those without a default.
+type paramList struct {
+	params   []*d.Token
+	defaults []d.Expr
+	rest     *d.Token
+}
+
+// parseParams parses a parameter list up to and including the closing ')'.
+// Params with defaults, 'b = 1', come after the others, and a rest param,
+// '...rest', comes last.
+func (p *Parser) parseParams() (paramList, error) {
+	list := paramList{
+		params:   make([]*d.Token, 0),
+		defaults: make([]d.Expr, 0),
+	}
+	if !p.check(d.RIGHT_PAREN) {
+		for {
+			if len(list.params) >= maxArgsSize {
+				return paramList{}, ErrParse{
+					message: fmt.Sprintf("Can't have more than %d params.", maxArgsSize),
+					token:   p.peek(),
+				}
+			}
+
+			if p.match(d.ELLIPSIS) {
+				rest, err := p.consume(d.IDENTIFIER, "Expect parameter name after '...'.")
+				if err != nil {
+					return paramList{}, err
+				}
+				list.rest = rest
+				if p.check(d.COMMA) {
+					return paramList{}, ErrParse{message: "Rest parameter must be last.", token: p.peek()}
+				}
+				break
+			}
+
+			param, err := p.consume(d.IDENTIFIER, "Expect parameter name")
+			if err != nil {
+				return paramList{}, err
+			}
+
+			var def d.Expr
+			if p.match(d.EQUAL) {
+				def, err = p.parseExpression()
+				if err != nil {
+					return paramList{}, err
+				}
+			} else if n := len(list.defaults); n > 0 && list.defaults[n-1] != nil {
+				return paramList{}, ErrParse{
+					message: "Parameter without a default can't follow one with a default.",
+					token:   param,
+				}
+			}
+			list.params = append(list.params, param)
+			list.defaults = append(list.defaults, def)
+
+			if !p.match(d.COMMA) {
+				break
+			}
+		}
+	}
+
+	_, err := p.consume(d.RIGHT_PAREN, "Expect ')' after paramters.")
+	if err != nil {
+		return paramList{}, err
+	}
+
+	return list, nil
+}
+
 func (p *Parser) parseVarDeclaration() (d.Stmt, error) {
+	keyword := p.previous()
 	name, err := p.consume(d.IDENTIFIER, "Expect var name")
 	if err != nil {
 		return nil, err
@@ -197,12 +374,22 @@ func (p *Parser) parseVarDeclaration() (d.Stmt, error) {
 	return d.VarStmt{
 		Name:        name,
 		Initializer: init,
+		Span:        p.spanFrom(keyword),
 	}, nil
 }
 
 func (p *Parser) parseStatement() (d.Stmt, error) {
+	if p.check(d.IDENTIFIER) && p.checkAt(1, d.COLON) {
+		return p.parseLabeledStmt()
+	}
+	if p.match(d.BREAK) {
+		return p.parseBreakStmt()
+	}
+	if p.match(d.CONTINUE) {
+		return p.parseContinueStmt()
+	}
 	if p.match(d.FOR) {
-		return p.parseForStmt()
+		return p.parseForStmt(nil)
 	}
 	if p.match(d.IF) {
 		return p.parseIfStmt()
@@ -214,28 +401,106 @@ func (p *Parser) parseStatement() (d.Stmt, error) {
 		return p.parseReturnStatement()
 	}
 	if p.match(d.WHILE) {
-		return p.parseWhileStatement()
+		return p.parseWhileStatement(nil)
+	}
+	if p.match(d.THROW) {
+		return p.parseThrowStmt()
+	}
+	if p.match(d.TRY) {
+		return p.parseTryStmt()
 	}
 	if p.match(d.LEFT_BRACE) {
+		brace := p.previous()
 		stmts, err := p.parseBlock()
 		if err != nil {
 			return nil, err
 		}
 		return d.BlockStmt{
 			Stmts: stmts,
+			Span:  p.spanFrom(brace),
 		}, nil
 	}
 
 	return p.parseExpressionStmt()
 }
 
-func (p *Parser) parseForStmt() (d.Stmt, error) {
+// parseLabeledStmt parses 'name: while (...)' or 'name: for (...)', the
+// label letting break and continue target an outer loop.
+func (p *Parser) parseLabeledStmt() (d.Stmt, error) {
+	label := p.advance()
+	p.advance()
+
+	if p.match(d.FOR) {
+		return p.parseForStmt(label)
+	}
+	if p.match(d.WHILE) {
+		return p.parseWhileStatement(label)
+	}
+
+	return nil, ErrParse{message: "Expect loop after label.", token: p.peek()}
+}
+
+func (p *Parser) parseBreakStmt() (d.Stmt, error) {
+	keyword := p.previous()
+	label, err := p.parseJumpLabel("break")
+	if err != nil {
+		return nil, err
+	}
+
+	return d.BreakStmt{
+		Keyword: keyword,
+		Label:   label,
+		Span:    p.spanFrom(keyword),
+	}, nil
+}
+
+func (p *Parser) parseContinueStmt() (d.Stmt, error) {
+	keyword := p.previous()
+	label, err := p.parseJumpLabel("continue")
+	if err != nil {
+		return nil, err
+	}
+
+	return d.ContinueStmt{
+		Keyword: keyword,
+		Label:   label,
+		Span:    p.spanFrom(keyword),
+	}, nil
+}
+
+// parseJumpLabel parses the optional label and the ';' ending a break or
+// continue statement.
+func (p *Parser) parseJumpLabel(keyword string) (*d.Token, error) {
+	var label *d.Token
+	if p.match(d.IDENTIFIER) {
+		label = p.previous()
+	}
+
+	_, err := p.consume(d.SEMICOLON, fmt.Sprintf("Expect ';' after '%s'.", keyword))
+	if err != nil {
+		return nil, err
+	}
+
+	return label, nil
+}
+
+func (p *Parser) parseForStmt(label *d.Token) (d.Stmt, error) {
+	keyword := p.previous()
+	start := keyword
+	if label != nil {
+		start = label
+	}
+
 	// Consume tokens
 	_, err := p.consume(d.LEFT_PAREN, "Expect '(' after 'for'")
 	if err != nil {
 		return nil, err
 	}
 
+	if p.isForIn() {
+		return p.parseForInStmt(keyword, start, label)
+	}
+
 	var initializer d.Stmt
 	if p.match(d.SEMICOLON) {
 		initializer = nil
@@ -258,7 +523,7 @@ func (p *Parser) parseForStmt() (d.Stmt, error) {
 			return nil, err
 		}
 	} else {
-		condition = d.LiteralExpr{Value: true}
+		condition = d.LiteralExpr{Value: true, Span: p.peek().Span}
 	}
 	_, err = p.consume(d.SEMICOLON, "Expect ';' after loop condition.")
 	if err != nil {
@@ -282,26 +547,72 @@ func (p *Parser) parseForStmt() (d.Stmt, error) {
 		return nil, err
 	}
 
-	// Sugarfy
-	if increment != nil {
-		body = d.BlockStmt{
-			Stmts: []d.Stmt{body, d.ExpressionStmt{Expression: increment}},
-		}
-	}
+	// Sugarfy, the generated nodes all cover the whole for statement. The
+	// increment stays on the loop so that continue still runs it.
+	span := p.spanFrom(start)
 	body = d.WhileStmt{
 		Condition: condition,
 		Body:      body,
+		Increment: increment,
+		Label:     label,
+		Span:      span,
 	}
 	if initializer != nil {
 		body = d.BlockStmt{
 			Stmts: []d.Stmt{initializer, body},
+			Span:  span,
 		}
 	}
 
 	return body, nil
 }
 
+// isForIn looks past the '(' for 'x in' or 'x, y in'.
+func (p *Parser) isForIn() bool {
+	if !p.check(d.IDENTIFIER) {
+		return false
+	}
+	if p.checkAt(1, d.IN) {
+		return true
+	}
+	return p.checkAt(1, d.COMMA) && p.checkAt(2, d.IDENTIFIER) && p.checkAt(3, d.IN)
+}
+
+// parseForInStmt parses the rest of 'for (x in xs) body' or
+// 'for (k, v in m) body'.
+func (p *Parser) parseForInStmt(keyword *d.Token, start *d.Token, label *d.Token) (d.Stmt, error) {
+	vars := []*d.Token{p.advance()}
+	if p.match(d.COMMA) {
+		vars = append(vars, p.advance())
+	}
+	p.advance()
+
+	iterable, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.consume(d.RIGHT_PAREN, "Expect ')' after for-in clause.")
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.ForInStmt{
+		Keyword:  keyword,
+		Vars:     vars,
+		Iterable: iterable,
+		Body:     body,
+		Label:    label,
+		Span:     p.spanFrom(start),
+	}, nil
+}
+
 func (p *Parser) parseIfStmt() (d.Stmt, error) {
+	keyword := p.previous()
 	_, err := p.consume(d.LEFT_PAREN, "Expect '(' after 'if'.")
 	if err != nil {
 		return nil, err
@@ -331,10 +642,16 @@ func (p *Parser) parseIfStmt() (d.Stmt, error) {
 		Condition:  condition,
 		ThenBranch: thenBranch,
 		ElseBranch: elseBranch,
+		Span:       p.spanFrom(keyword),
 	}, nil
 }
 
-func (p *Parser) parseWhileStatement() (d.Stmt, error) {
+func (p *Parser) parseWhileStatement(label *d.Token) (d.Stmt, error) {
+	keyword := p.previous()
+	start := keyword
+	if label != nil {
+		start = label
+	}
 	_, err := p.consume(d.LEFT_PAREN, "Expect '(' after 'while'.")
 	if err != nil {
 		return nil, err
@@ -356,10 +673,96 @@ func (p *Parser) parseWhileStatement() (d.Stmt, error) {
 	return d.WhileStmt{
 		Condition: condition,
 		Body:      body,
+		Label:     label,
+		Span:      p.spanFrom(start),
+	}, nil
+}
+
+func (p *Parser) parseThrowStmt() (d.Stmt, error) {
+	keyword := p.previous()
+	value, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(d.SEMICOLON, "Expect ';' after thrown value.")
+	if err != nil {
+		return nil, err
+	}
+
+	return d.ThrowStmt{
+		Keyword: keyword,
+		Value:   value,
+		Span:    p.spanFrom(keyword),
+	}, nil
+}
+
+// parseTryStmt parses 'try {} catch (e) {} finally {}', where either the
+// catch or the finally clause may be left out but not both.
+func (p *Parser) parseTryStmt() (d.Stmt, error) {
+	keyword := p.previous()
+	_, err := p.consume(d.LEFT_BRACE, "Expect '{' after 'try'.")
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var catchName *d.Token
+	var catch []d.Stmt
+	if p.match(d.CATCH) {
+		_, err = p.consume(d.LEFT_PAREN, "Expect '(' after 'catch'.")
+		if err != nil {
+			return nil, err
+		}
+		catchName, err = p.consume(d.IDENTIFIER, "Expect name of the caught value.")
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.consume(d.RIGHT_PAREN, "Expect ')' after caught name.")
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.consume(d.LEFT_BRACE, "Expect '{' before catch body.")
+		if err != nil {
+			return nil, err
+		}
+		catch, err = p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var finally []d.Stmt
+	if p.match(d.FINALLY) {
+		_, err = p.consume(d.LEFT_BRACE, "Expect '{' after 'finally'.")
+		if err != nil {
+			return nil, err
+		}
+		finally, err = p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if catchName == nil && finally == nil {
+		return nil, ErrParse{message: "Expect 'catch' or 'finally' after try block.", token: p.peek()}
+	}
+
+	return d.TryStmt{
+		Keyword:   keyword,
+		Body:      body,
+		CatchName: catchName,
+		Catch:     catch,
+		Finally:   finally,
+		Span:      p.spanFrom(keyword),
 	}, nil
 }
 
 func (p *Parser) parsePrintStatement() (d.Stmt, error) {
+	keyword := p.previous()
 	ex, err := p.parseExpression()
 	if err != nil {
 		return nil, err
@@ -372,6 +775,7 @@ func (p *Parser) parsePrintStatement() (d.Stmt, error) {
 
 	return d.PrintStmt{
 		Expression: ex,
+		Span:       p.spanFrom(keyword),
 	}, nil
 }
 
@@ -395,10 +799,16 @@ func (p *Parser) parseReturnStatement() (d.Stmt, error) {
 	return d.ReturnStmt{
 		Keyword: keyword,
 		Value:   value,
+		Span:    p.spanFrom(keyword),
 	}, nil
 }
 
 func (p *Parser) parseBlock() ([]d.Stmt, error) {
+	p.blockDepth++
+	defer func() {
+		p.blockDepth--
+	}()
+
 	stmts := make([]d.Stmt, 0)
 
 	for !p.check(d.RIGHT_BRACE) && !p.isAtEnd() {
@@ -407,7 +817,9 @@ func (p *Parser) parseBlock() ([]d.Stmt, error) {
 			return nil, err
 		}
 
-		stmts = append(stmts, s)
+		if s != nil {
+			stmts = append(stmts, s)
+		}
 	}
 
 	_, err := p.consume(d.RIGHT_BRACE, "Expect '}' after block.")
@@ -431,6 +843,7 @@ func (p *Parser) parseExpressionStmt() (d.Stmt, error) {
 
 	return d.ExpressionStmt{
 		Expression: ex,
+		Span:       ex.GetSpan().Join(p.previous().Span),
 	}, nil
 }
 
@@ -451,17 +864,28 @@ func (p *Parser) parseAssignment() (d.Expr, error) {
 			return nil, err
 		}
 
+		span := eqExpr.GetSpan().Join(value.GetSpan())
 		switch eqExprRaw := eqExpr.(type) {
 		case d.VariableExpr:
 			return d.AssignExpr{
 				Name:  eqExprRaw.Name,
 				Value: value,
+				Span:  span,
 			}, nil
 		case d.GetExpr:
 			return d.SetExpr{
 				Object: eqExprRaw.Object,
 				Name:   eqExprRaw.Name,
 				Value:  value,
+				Span:   span,
+			}, nil
+		case d.IndexExpr:
+			return d.IndexSetExpr{
+				Object:  eqExprRaw.Object,
+				Bracket: eqExprRaw.Bracket,
+				Index:   eqExprRaw.Index,
+				Value:   value,
+				Span:    span,
 			}, nil
 		}
 
@@ -488,6 +912,7 @@ func (p *Parser) parseOr() (d.Expr, error) {
 			Left:     expr,
 			Operator: operator,
 			Right:    right,
+			Span:     expr.GetSpan().Join(right.GetSpan()),
 		}
 	}
 
@@ -511,6 +936,7 @@ func (p *Parser) parseAnd() (d.Expr, error) {
 			Left:     expr,
 			Operator: operator,
 			Right:    right,
+			Span:     expr.GetSpan().Join(right.GetSpan()),
 		}
 	}
 
@@ -533,6 +959,7 @@ func (p *Parser) parseEquality() (d.Expr, error) {
 			Left:     expr,
 			Operator: operator,
 			Right:    right,
+			Span:     expr.GetSpan().Join(right.GetSpan()),
 		}
 	}
 
@@ -555,6 +982,7 @@ func (p *Parser) parseComparison() (d.Expr, error) {
 			Left:     expr,
 			Operator: operator,
 			Right:    right,
+			Span:     expr.GetSpan().Join(right.GetSpan()),
 		}
 	}
 
@@ -577,6 +1005,7 @@ func (p *Parser) parseTerm() (d.Expr, error) {
 			Left:     expr,
 			Operator: operator,
 			Right:    right,
+			Span:     expr.GetSpan().Join(right.GetSpan()),
 		}
 	}
 
@@ -599,6 +1028,7 @@ func (p *Parser) parseFactor() (d.Expr, error) {
 			Left:     expr,
 			Operator: operator,
 			Right:    right,
+			Span:     expr.GetSpan().Join(right.GetSpan()),
 		}
 	}
 
@@ -615,6 +1045,7 @@ func (p *Parser) parseUnary() (d.Expr, error) {
 		return d.UnaryExpr{
 			Operator: operator,
 			Right:    right,
+			Span:     operator.Span.Join(right.GetSpan()),
 		}, nil
 	}
 
@@ -641,6 +1072,12 @@ func (p *Parser) parseCall() (d.Expr, error) {
 			expr = d.GetExpr{
 				Object: expr,
 				Name:   name,
+				Span:   expr.GetSpan().Join(name.Span),
+			}
+		} else if p.match(d.LEFT_BRACKET) {
+			expr, err = p.finishIndex(expr)
+			if err != nil {
+				return nil, err
 			}
 		} else {
 			break
@@ -685,6 +1122,56 @@ func (p *Parser) finishCall(callee d.Expr) (d.Expr, error) {
 		Callee: callee,
 		Paren:  parenToken,
 		Args:   args,
+		Span:   callee.GetSpan().Join(parenToken.Span),
+	}, nil
+}
+
+// finishIndex parses the rest of 'xs[i]' or the slice 'xs[start:end]',
+// where either bound of a slice may be left out.
+func (p *Parser) finishIndex(object d.Expr) (d.Expr, error) {
+	bracket := p.previous()
+
+	var start d.Expr
+	var err error
+	if !p.check(d.COLON) {
+		start, err = p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !p.match(d.COLON) {
+		closing, err := p.consume(d.RIGHT_BRACKET, "Expect ']' after index.")
+		if err != nil {
+			return nil, err
+		}
+		return d.IndexExpr{
+			Object:  object,
+			Bracket: bracket,
+			Index:   start,
+			Span:    object.GetSpan().Join(closing.Span),
+		}, nil
+	}
+
+	var end d.Expr
+	if !p.check(d.RIGHT_BRACKET) {
+		end, err = p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	closing, err := p.consume(d.RIGHT_BRACKET, "Expect ']' after slice.")
+	if err != nil {
+		return nil, err
+	}
+
+	return d.SliceExpr{
+		Object:  object,
+		Bracket: bracket,
+		Start:   start,
+		End:     end,
+		Span:    object.GetSpan().Join(closing.Span),
 	}, nil
 }
 
@@ -692,25 +1179,49 @@ func (p *Parser) parsePrimary() (d.Expr, error) {
 	if p.match(d.FALSE) {
 		return d.LiteralExpr{
 			Value: false,
+			Span:  p.previous().Span,
 		}, nil
 	}
 	if p.match(d.TRUE) {
 		return d.LiteralExpr{
 			Value: true,
+			Span:  p.previous().Span,
 		}, nil
 	}
 	if p.match(d.NIL) {
 		return d.LiteralExpr{
 			Value: nil,
+			Span:  p.previous().Span,
 		}, nil
 	}
 
 	if p.match(d.NUMBER, d.STRING) {
 		return d.LiteralExpr{
 			Value: p.previous().Literal,
+			Span:  p.previous().Span,
 		}, nil
 	}
 
+	if p.match(d.INTERPOLATION) {
+		return p.parseInterpolation()
+	}
+
+	if p.match(d.FUN) {
+		return p.parseLambda()
+	}
+
+	if p.check(d.LEFT_PAREN) && p.isArrowLambda() {
+		return p.parseArrowLambda()
+	}
+
+	if p.match(d.LEFT_BRACKET) {
+		return p.parseList()
+	}
+
+	if p.match(d.LEFT_BRACE) {
+		return p.parseMap()
+	}
+
 	if p.match(d.SUPER) {
 		keyword := p.previous()
 		_, err := p.consume(d.DOT, "Expect '.' after 'super'.")
@@ -725,22 +1236,26 @@ func (p *Parser) parsePrimary() (d.Expr, error) {
 		return d.SuperExpr{
 			Keyword: keyword,
 			Method:  method,
+			Span:    keyword.Span.Join(method.Span),
 		}, nil
 	}
 
 	if p.match(d.THIS) {
 		return d.ThisExpr{
 			Keyword: p.previous(),
+			Span:    p.previous().Span,
 		}, nil
 	}
 
 	if p.match(d.IDENTIFIER) {
 		return d.VariableExpr{
 			Name: p.previous(),
+			Span: p.previous().Span,
 		}, nil
 	}
 
 	if p.match(d.LEFT_PAREN) {
+		paren := p.previous()
 		expr, err := p.parseExpression()
 		if err != nil {
 			return nil, err
@@ -751,12 +1266,234 @@ func (p *Parser) parsePrimary() (d.Expr, error) {
 		}
 		return d.GroupingExpr{
 			Expression: expr,
+			Span:       p.spanFrom(paren),
 		}, nil
 	}
 
 	return nil, ErrParse{message: "Expected expression.", token: p.peek()}
 }
 
+// parseList parses a list literal, allowing a trailing comma.
+func (p *Parser) parseList() (d.Expr, error) {
+	bracket := p.previous()
+	elements := make([]d.Expr, 0)
+
+	for !p.check(d.RIGHT_BRACKET) {
+		element, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+
+		if !p.match(d.COMMA) {
+			break
+		}
+	}
+
+	_, err := p.consume(d.RIGHT_BRACKET, "Expect ']' after list elements.")
+	if err != nil {
+		return nil, err
+	}
+
+	return d.ListExpr{
+		Bracket:  bracket,
+		Elements: elements,
+		Span:     p.spanFrom(bracket),
+	}, nil
+}
+
+// parseMap parses a map literal such as '{"a": 1, "b": 2}'. Blocks are
+// statements, so a '{' starting an expression always opens a map.
+func (p *Parser) parseMap() (d.Expr, error) {
+	brace := p.previous()
+	keys := make([]d.Expr, 0)
+	values := make([]d.Expr, 0)
+
+	for !p.check(d.RIGHT_BRACE) {
+		key, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.consume(d.COLON, "Expect ':' after map key.")
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+
+		if !p.match(d.COMMA) {
+			break
+		}
+	}
+
+	_, err := p.consume(d.RIGHT_BRACE, "Expect '}' after map entries.")
+	if err != nil {
+		return nil, err
+	}
+
+	return d.MapExpr{
+		Brace:  brace,
+		Keys:   keys,
+		Values: values,
+		Span:   p.spanFrom(brace),
+	}, nil
+}
+
+// parseInterpolation parses the rest of a string containing "${...}"
+// expressions. The scanner splits it into INTERPOLATION tokens for each text
+// segment ending in "${", finishing with a STRING token for the last one.
+func (p *Parser) parseInterpolation() (d.Expr, error) {
+	start := p.previous()
+	parts := make([]d.Expr, 0)
+	for {
+		segment := p.previous()
+		if segment.Literal != "" {
+			parts = append(parts, d.LiteralExpr{Value: segment.Literal, Span: segment.Span})
+		}
+
+		if segment.Kind == d.STRING {
+			break
+		}
+
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, expr)
+
+		if !p.match(d.INTERPOLATION, d.STRING) {
+			return nil, ErrParse{message: "Expect '}' after interpolated expression.", token: p.peek()}
+		}
+	}
+
+	return d.InterpolationExpr{
+		Parts: parts,
+		Span:  p.spanFrom(start),
+	}, nil
+}
+
+// parseLambda parses an anonymous function, 'fun (a, b) { ... }', after
+// the 'fun' keyword.
+func (p *Parser) parseLambda() (d.Expr, error) {
+	keyword := p.previous()
+	_, err := p.consume(d.LEFT_PAREN, "Expect '(' after 'fun'.")
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := p.parseParams()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(d.LEFT_BRACE, "Expect '{' before function body.")
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.LambdaExpr{
+		Keyword:  keyword,
+		Params:   params.params,
+		Defaults: params.defaults,
+		Rest:     params.rest,
+		Body:     body,
+		Span:     p.spanFrom(keyword),
+	}, nil
+}
+
+// isArrowLambda looks ahead from a '(' for a parameter list followed by
+// '=>', telling an arrow function apart from a grouping.
+func (p *Parser) isArrowLambda() bool {
+	i := 1
+	if !p.checkAt(i, d.RIGHT_PAREN) {
+		for {
+			if p.checkAt(i, d.ELLIPSIS) {
+				i++
+			}
+			if !p.checkAt(i, d.IDENTIFIER) {
+				return false
+			}
+			i++
+			if p.checkAt(i, d.EQUAL) {
+				i = p.skipDefault(i + 1)
+			}
+			if !p.checkAt(i, d.COMMA) {
+				break
+			}
+			i++
+		}
+	}
+
+	return p.checkAt(i, d.RIGHT_PAREN) && p.checkAt(i+1, d.ARROW)
+}
+
+// skipDefault looks past a default value starting i tokens ahead, to the
+// ',' or ')' that ends it.
+func (p *Parser) skipDefault(i int) int {
+	depth := 0
+	for ; !p.checkAt(i, d.EOF) && p.current+i < len(p.tokens); i++ {
+		switch {
+		case p.checkAt(i, d.LEFT_PAREN), p.checkAt(i, d.LEFT_BRACKET), p.checkAt(i, d.LEFT_BRACE):
+			depth++
+		case p.checkAt(i, d.RIGHT_PAREN), p.checkAt(i, d.RIGHT_BRACKET), p.checkAt(i, d.RIGHT_BRACE):
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case p.checkAt(i, d.COMMA):
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+// parseArrowLambda parses '(a, b) => expr' or '(a, b) => { ... }'.
+func (p *Parser) parseArrowLambda() (d.Expr, error) {
+	start := p.advance()
+	params, err := p.parseParams()
+	if err != nil {
+		return nil, err
+	}
+	arrow, err := p.consume(d.ARROW, "Expect '=>' after parameters.")
+	if err != nil {
+		return nil, err
+	}
+
+	var body []d.Stmt
+	if p.match(d.LEFT_BRACE) {
+		body, err = p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		value, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		body = []d.Stmt{d.ReturnStmt{Keyword: arrow, Value: value, Span: value.GetSpan()}}
+	}
+
+	return d.LambdaExpr{
+		Keyword:  arrow,
+		Params:   params.params,
+		Defaults: params.defaults,
+		Rest:     params.rest,
+		Body:     body,
+		Span:     p.spanFrom(start),
+	}, nil
+}
+
 func (p *Parser) consume(t d.TokenType, message string) (*d.Token, error) {
 	if p.check(t) {
 		return p.advance(), nil
@@ -765,7 +1502,17 @@ func (p *Parser) consume(t d.TokenType, message string) (*d.Token, error) {
 	return nil, ErrParse{message: message, token: p.peek()}
 }
 
+// spanFrom returns the span from the start of the given token to the end of
+// the most recently consumed token.
+func (p *Parser) spanFrom(start *d.Token) d.Span {
+	return start.Span.Join(p.previous().Span)
+}
+
 func (p *Parser) sync() {
+	// Leave closing braces for the enclosing block to consume
+	if p.blockDepth > 0 && p.check(d.RIGHT_BRACE) {
+		return
+	}
 	p.advance()
 
 	for !p.isAtEnd() {
@@ -774,15 +1521,12 @@ func (p *Parser) sync() {
 		}
 
 		switch p.peek().Kind {
-		case d.CLASS:
-		case d.FUN:
-		case d.VAR:
-		case d.FOR:
-		case d.IF:
-		case d.WHILE:
-		case d.PRINT:
-		case d.RETURN:
+		case d.CLASS, d.FUN, d.VAR, d.FOR, d.IF, d.WHILE, d.PRINT, d.RETURN, d.BREAK, d.CONTINUE, d.THROW, d.TRY:
 			return
+		case d.RIGHT_BRACE:
+			if p.blockDepth > 0 {
+				return
+			}
 		}
 
 		p.advance()
@@ -806,6 +1550,15 @@ func (p *Parser) check(t d.TokenType) bool {
 	return p.peek().Kind == t
 }
 
+// checkAt checks the kind of the token n places after the current one.
+func (p *Parser) checkAt(n int, t d.TokenType) bool {
+	p.fill(p.current + n)
+	if p.current+n >= len(p.tokens) {
+		return false
+	}
+	return p.tokens[p.current+n].Kind == t
+}
+
 func (p *Parser) advance() *d.Token {
 	if !p.isAtEnd() {
 		p.current++
@@ -819,12 +1572,42 @@ func (p *Parser) isAtEnd() bool {
 }
 
 func (p *Parser) peek() *d.Token {
+	p.fill(p.current)
 	if p.current >= len(p.tokens) {
 		return nil
 	}
 	return p.tokens[p.current]
 }
 
+// fill pulls tokens from the source until index i is buffered. Errors from
+// the source are recorded and skipped.
+func (p *Parser) fill(i int) {
+	for len(p.tokens) <= i && !p.exhausted {
+		t, err := p.source.Next()
+		if err != nil {
+			// The scanner error is the diagnostic, so parse errors at the
+			// token standing in for it aren't reported
+			p.errs = append(p.errs, err)
+			var spanErr interface{ Span() d.Span }
+			var span d.Span
+			if errors.As(err, &spanErr) {
+				span = spanErr.Span()
+			}
+			p.tokens = append(p.tokens, d.NewTokenAt(d.ERROR, "", nil, span))
+			continue
+		}
+
+		if t == nil {
+			p.exhausted = true
+			return
+		}
+		p.tokens = append(p.tokens, t)
+		if t.Kind == d.EOF {
+			p.exhausted = true
+		}
+	}
+}
+
 func (p *Parser) previous() *d.Token {
 	return p.tokens[p.current-1]
 }
@@ -2,8 +2,11 @@ package ast
 
 import (
 	d "example/compilers/domain"
+	"example/compilers/lex"
 	"example/compilers/util"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -198,9 +201,8 @@ func TestParse(t *testing.T) {
 		{[]*d.Token{forToken, openBracket, semicolon, semicolon, one, closeBracket, openBlockToken, printToken, one, semicolon, closeBlockToken},
 			d.WhileStmt{
 				Condition: d.LiteralExpr{Value: true},
-				Body: d.BlockStmt{
-					Stmts: []d.Stmt{d.BlockStmt{Stmts: []d.Stmt{d.PrintStmt{Expression: d.LiteralExpr{Value: 1}}}}, d.ExpressionStmt{Expression: d.LiteralExpr{Value: 1}}},
-				},
+				Body:      d.BlockStmt{Stmts: []d.Stmt{d.PrintStmt{Expression: d.LiteralExpr{Value: 1}}}},
+				Increment: d.LiteralExpr{Value: 1},
 			},
 		},
 		// Initializer
@@ -223,11 +225,9 @@ func TestParse(t *testing.T) {
 					d.WhileStmt{
 						Condition: d.LiteralExpr{Value: "a"},
 						Body: d.BlockStmt{Stmts: []d.Stmt{
-							d.BlockStmt{Stmts: []d.Stmt{
-								d.PrintStmt{Expression: d.LiteralExpr{Value: 1}},
-							}},
-							d.ExpressionStmt{Expression: d.LiteralExpr{Value: 1}},
+							d.PrintStmt{Expression: d.LiteralExpr{Value: 1}},
 						}},
+						Increment: d.LiteralExpr{Value: 1},
 					},
 				},
 			},
@@ -489,4 +489,436 @@ func TestParse(t *testing.T) {
 		_, err := NewParser(bigFnTokens).Parse()
 		assert.Error(err)
 	})
+
+	t.Run("Parses node spans", func(t *testing.T) {
+		assert := assert.New(t)
+
+		at := func(line, col, offset int) d.Position {
+			return d.Position{Line: line, Column: col, Offset: offset}
+		}
+		spanned := func(kind d.TokenType, lexeme string, literal interface{}, start, end d.Position) *d.Token {
+			return d.NewTokenAt(kind, lexeme, literal, d.Span{Start: start, End: end})
+		}
+
+		// print 1 + x;
+		rawTokens := []*d.Token{
+			spanned(d.PRINT, "print", nil, at(1, 1, 0), at(1, 6, 5)),
+			spanned(d.NUMBER, "1", 1.0, at(1, 7, 6), at(1, 8, 7)),
+			spanned(d.PLUS, "+", nil, at(1, 9, 8), at(1, 10, 9)),
+			spanned(d.IDENTIFIER, "x", nil, at(1, 11, 10), at(1, 12, 11)),
+			spanned(d.SEMICOLON, ";", nil, at(1, 12, 11), at(1, 13, 12)),
+			spanned(d.EOF, "", nil, at(1, 13, 12), at(1, 13, 12)),
+		}
+
+		stmts, err := NewParser(rawTokens).Parse()
+		assert.NoError(err)
+		assert.Len(stmts, 1)
+
+		printStmt := stmts[0].(d.PrintStmt)
+		assert.Equal(d.Span{Start: at(1, 1, 0), End: at(1, 13, 12)}, printStmt.GetSpan())
+
+		binary := printStmt.Expression.(d.BinaryExpr)
+		assert.Equal(d.Span{Start: at(1, 7, 6), End: at(1, 12, 11)}, binary.GetSpan())
+		assert.Equal(d.Span{Start: at(1, 7, 6), End: at(1, 8, 7)}, binary.Left.GetSpan())
+		assert.Equal(d.Span{Start: at(1, 11, 10), End: at(1, 12, 11)}, binary.Right.GetSpan())
+	})
+
+	t.Run("Reports every syntax error", func(t *testing.T) {
+		assert := assert.New(t)
+
+		rawTokens := []*d.Token{
+			printToken, semicolon,
+			varToken, vToken, eqToken, one, semicolon,
+			openBlockToken, printToken, one, closeBlockToken,
+			printToken, one, semicolon,
+			d.NewToken(d.EOF, "", nil, 0),
+		}
+
+		stmts, err := NewParser(rawTokens).Parse()
+		assert.Error(err)
+
+		var errSyntax ErrSyntax
+		assert.ErrorAs(err, &errSyntax)
+		assert.Len(errSyntax.Unwrap(), 2)
+		for _, e := range errSyntax.Unwrap() {
+			assert.IsType(ErrParse{}, e)
+		}
+
+		assert.Len(stmts, 3)
+		for _, st := range stmts {
+			assert.NotNil(st)
+		}
+		assert.True(util.IsEqualStmt(d.VarStmt{Name: vToken, Initializer: d.LiteralExpr{Value: 1}}, stmts[0]))
+		assert.True(util.IsEqualStmt(d.BlockStmt{Stmts: []d.Stmt{}}, stmts[1]))
+		assert.True(util.IsEqualStmt(d.PrintStmt{Expression: d.LiteralExpr{Value: 1}}, stmts[2]))
+	})
+
+	t.Run("Parses string interpolation", func(t *testing.T) {
+		assert := assert.New(t)
+
+		rawTokens := []*d.Token{
+			d.NewToken(d.INTERPOLATION, `"Hi ${`, "Hi ", 0),
+			vToken,
+			d.NewToken(d.INTERPOLATION, `}${`, "", 0),
+			one, plus, one,
+			d.NewToken(d.STRING, `}!"`, "!", 0),
+			semicolon,
+		}
+
+		stmts, err := NewParser(rawTokens).Parse()
+		assert.NoError(err)
+		assert.Len(stmts, 1)
+
+		expectedStmt := d.ExpressionStmt{Expression: d.InterpolationExpr{Parts: []d.Expr{
+			d.LiteralExpr{Value: "Hi "},
+			d.VariableExpr{Name: vToken},
+			d.BinaryExpr{Left: d.LiteralExpr{Value: 1}, Operator: plus, Right: d.LiteralExpr{Value: 1}},
+			d.LiteralExpr{Value: "!"},
+		}}}
+		assert.True(util.IsEqualStmt(expectedStmt, stmts[0]))
+	})
+
+	t.Run("Errors unclosed string interpolation", func(t *testing.T) {
+		assert := assert.New(t)
+
+		rawTokens := []*d.Token{d.NewToken(d.INTERPOLATION, `"Hi ${`, "Hi ", 0), vToken, semicolon}
+
+		_, err := NewParser(rawTokens).Parse()
+		assert.Error(err)
+	})
+
+	t.Run("Parses anonymous functions", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "var f = fun (a, b) { return a + b; };\nfun () {};"
+		stmts, err := NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(err)
+		assert.Len(stmts, 2)
+
+		aToken := d.NewToken(d.IDENTIFIER, "a", nil, 0)
+		bToken := d.NewToken(d.IDENTIFIER, "b", nil, 0)
+		expectedStmt := d.VarStmt{
+			Name: d.NewToken(d.IDENTIFIER, "f", nil, 0),
+			Initializer: d.LambdaExpr{
+				Keyword: d.NewToken(d.FUN, "fun", nil, 0),
+				Params:  []*d.Token{aToken, bToken},
+				Body: []d.Stmt{d.ReturnStmt{
+					Keyword: returnToken,
+					Value:   d.BinaryExpr{Left: d.VariableExpr{Name: aToken}, Operator: plus, Right: d.VariableExpr{Name: bToken}},
+				}},
+			},
+		}
+		assert.True(util.IsEqualStmt(expectedStmt, stmts[0]))
+
+		expression, ok := stmts[1].(d.ExpressionStmt)
+		assert.True(ok)
+		assert.IsType(d.LambdaExpr{}, expression.Expression)
+	})
+
+	t.Run("Parses arrow functions", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "(a) => a * 2;\n() => { print 1; };\n(a);"
+		stmts, err := NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(err)
+		assert.Len(stmts, 3)
+
+		aToken := d.NewToken(d.IDENTIFIER, "a", nil, 0)
+		arrowToken := d.NewToken(d.ARROW, "=>", nil, 0)
+		expectedStmts := []d.Stmt{
+			d.ExpressionStmt{Expression: d.LambdaExpr{
+				Keyword: arrowToken,
+				Params:  []*d.Token{aToken},
+				Body: []d.Stmt{d.ReturnStmt{
+					Keyword: arrowToken,
+					Value:   d.BinaryExpr{Left: d.VariableExpr{Name: aToken}, Operator: mult, Right: d.LiteralExpr{Value: 2.0}},
+				}},
+			}},
+			d.ExpressionStmt{Expression: d.LambdaExpr{
+				Keyword: arrowToken,
+				Params:  []*d.Token{},
+				Body:    []d.Stmt{d.PrintStmt{Expression: d.LiteralExpr{Value: 1.0}}},
+			}},
+			d.ExpressionStmt{Expression: d.GroupingExpr{Expression: d.VariableExpr{Name: aToken}}},
+		}
+		for i, expected := range expectedStmts {
+			assert.True(util.IsEqualStmt(expected, stmts[i]))
+		}
+	})
+
+	t.Run("Parses default and rest params", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "fun f(a, b = a + 1, ...rest) {}\n(a, b = [1, (2)], ...rest) => a;\n(...rest) => rest;\n(a = 1);"
+		stmts, err := NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(err)
+		assert.Len(stmts, 4)
+
+		aToken := d.NewToken(d.IDENTIFIER, "a", nil, 0)
+		bToken := d.NewToken(d.IDENTIFIER, "b", nil, 0)
+		restToken := d.NewToken(d.IDENTIFIER, "rest", nil, 0)
+		arrowToken := d.NewToken(d.ARROW, "=>", nil, 0)
+		expectedStmts := []d.Stmt{
+			d.FunctionStmt{
+				Name:     d.NewToken(d.IDENTIFIER, "f", nil, 0),
+				Params:   []*d.Token{aToken, bToken},
+				Defaults: []d.Expr{nil, d.BinaryExpr{Left: d.VariableExpr{Name: aToken}, Operator: plus, Right: d.LiteralExpr{Value: 1.0}}},
+				Rest:     restToken,
+				Body:     []d.Stmt{},
+			},
+			d.ExpressionStmt{Expression: d.LambdaExpr{
+				Keyword: arrowToken,
+				Params:  []*d.Token{aToken, bToken},
+				Defaults: []d.Expr{nil, d.ListExpr{Elements: []d.Expr{
+					d.LiteralExpr{Value: 1.0},
+					d.GroupingExpr{Expression: d.LiteralExpr{Value: 2.0}},
+				}}},
+				Rest: restToken,
+				Body: []d.Stmt{d.ReturnStmt{Keyword: arrowToken, Value: d.VariableExpr{Name: aToken}}},
+			}},
+			d.ExpressionStmt{Expression: d.LambdaExpr{
+				Keyword: arrowToken,
+				Params:  []*d.Token{},
+				Rest:    restToken,
+				Body:    []d.Stmt{d.ReturnStmt{Keyword: arrowToken, Value: d.VariableExpr{Name: restToken}}},
+			}},
+			d.ExpressionStmt{Expression: d.GroupingExpr{Expression: d.AssignExpr{Name: aToken, Value: d.LiteralExpr{Value: 1.0}}}},
+		}
+		for i, expected := range expectedStmts {
+			assert.True(util.IsEqualStmt(expected, stmts[i]), "stmt %d", i)
+		}
+	})
+
+	t.Run("Errors misplaced default and rest params", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var errParse ErrParse
+		_, err := NewSourceParser(lex.NewScanner("fun f(a = 1, b) {}")).Parse()
+		assert.ErrorAs(err, &errParse)
+		assert.Equal("Parameter without a default can't follow one with a default.", errParse.Message())
+
+		_, err = NewSourceParser(lex.NewScanner("fun f(...rest, a) {}")).Parse()
+		assert.ErrorAs(err, &errParse)
+		assert.Equal("Rest parameter must be last.", errParse.Message())
+
+		_, err = NewSourceParser(lex.NewScanner("fun f(...) {}")).Parse()
+		assert.Error(err)
+	})
+
+	t.Run("Parses break and continue with labels", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "outer: for (;;) { while (true) { continue outer; } break; }"
+		stmts, err := NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(err)
+		assert.Len(stmts, 1)
+
+		outerToken := d.NewToken(d.IDENTIFIER, "outer", nil, 0)
+		expectedStmt := d.WhileStmt{
+			Condition: d.LiteralExpr{Value: true},
+			Label:     outerToken,
+			Body: d.BlockStmt{Stmts: []d.Stmt{
+				d.WhileStmt{
+					Condition: d.LiteralExpr{Value: true},
+					Body: d.BlockStmt{Stmts: []d.Stmt{
+						d.ContinueStmt{Label: outerToken},
+					}},
+				},
+				d.BreakStmt{},
+			}},
+		}
+		assert.True(util.IsEqualStmt(expectedStmt, stmts[0]))
+	})
+
+	t.Run("Parses for-in loops", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "for (x in xs) print x;\nouter: for (k, v in m) {}\nfor (x; x; x) {}"
+		stmts, err := NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(err)
+		assert.Len(stmts, 3)
+
+		xToken := d.NewToken(d.IDENTIFIER, "x", nil, 0)
+		expectedStmts := []d.Stmt{
+			d.ForInStmt{
+				Vars:     []*d.Token{xToken},
+				Iterable: d.VariableExpr{Name: d.NewToken(d.IDENTIFIER, "xs", nil, 0)},
+				Body:     d.PrintStmt{Expression: d.VariableExpr{Name: xToken}},
+			},
+			d.ForInStmt{
+				Vars:     []*d.Token{d.NewToken(d.IDENTIFIER, "k", nil, 0), d.NewToken(d.IDENTIFIER, "v", nil, 0)},
+				Iterable: d.VariableExpr{Name: d.NewToken(d.IDENTIFIER, "m", nil, 0)},
+				Body:     d.BlockStmt{Stmts: []d.Stmt{}},
+				Label:    d.NewToken(d.IDENTIFIER, "outer", nil, 0),
+			},
+		}
+		for i, expected := range expectedStmts {
+			assert.True(util.IsEqualStmt(expected, stmts[i]))
+		}
+		assert.IsType(d.BlockStmt{}, stmts[2])
+	})
+
+	t.Run("Parses throw and try statements", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "try { throw 1; } catch (e) { print e; } finally {}\ntry {} finally {}"
+		stmts, err := NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(err)
+		assert.Len(stmts, 2)
+
+		eToken := d.NewToken(d.IDENTIFIER, "e", nil, 0)
+		expectedStmts := []d.Stmt{
+			d.TryStmt{
+				Body:      []d.Stmt{d.ThrowStmt{Value: d.LiteralExpr{Value: 1.0}}},
+				CatchName: eToken,
+				Catch:     []d.Stmt{d.PrintStmt{Expression: d.VariableExpr{Name: eToken}}},
+				Finally:   []d.Stmt{},
+			},
+			d.TryStmt{
+				Body:    []d.Stmt{},
+				Finally: []d.Stmt{},
+			},
+		}
+		for i, expected := range expectedStmts {
+			assert.True(util.IsEqualStmt(expected, stmts[i]))
+		}
+	})
+
+	t.Run("Errors try without catch or finally", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := NewSourceParser(lex.NewScanner("try {} print 1;")).Parse()
+		assert.Error(err)
+		_, err = NewSourceParser(lex.NewScanner("try {} catch {}")).Parse()
+		assert.Error(err)
+	})
+
+	t.Run("Errors label without a loop", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := NewSourceParser(lex.NewScanner("outer: print 1;")).Parse()
+		assert.Error(err)
+		_, err = NewSourceParser(lex.NewScanner("while (true) break")).Parse()
+		assert.Error(err)
+	})
+
+	t.Run("Parses lists, indexing and slices", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "[1, \"a\", [],];\nxs[0] = xs[-1];\nxs[1:];\nxs[:2];"
+		stmts, err := NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(err)
+		assert.Len(stmts, 4)
+
+		xs := d.VariableExpr{Name: d.NewToken(d.IDENTIFIER, "xs", nil, 0)}
+		expectedStmts := []d.Stmt{
+			d.ExpressionStmt{Expression: d.ListExpr{Elements: []d.Expr{
+				d.LiteralExpr{Value: 1.0},
+				d.LiteralExpr{Value: "a"},
+				d.ListExpr{Elements: []d.Expr{}},
+			}}},
+			d.ExpressionStmt{Expression: d.IndexSetExpr{
+				Object: xs,
+				Index:  d.LiteralExpr{Value: 0.0},
+				Value: d.IndexExpr{
+					Object: xs,
+					Index:  d.UnaryExpr{Operator: min, Right: d.LiteralExpr{Value: 1.0}},
+				},
+			}},
+			d.ExpressionStmt{Expression: d.SliceExpr{Object: xs, Start: d.LiteralExpr{Value: 1.0}}},
+			d.ExpressionStmt{Expression: d.SliceExpr{Object: xs, End: d.LiteralExpr{Value: 2.0}}},
+		}
+		for i, expected := range expectedStmts {
+			assert.True(util.IsEqualStmt(expected, stmts[i]))
+		}
+	})
+
+	t.Run("Parses map literals", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "var m = {\"a\": 1, k: [],};\nvar e = {};"
+		stmts, err := NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(err)
+		assert.Len(stmts, 2)
+
+		expectedStmts := []d.Stmt{
+			d.VarStmt{
+				Name: d.NewToken(d.IDENTIFIER, "m", nil, 0),
+				Initializer: d.MapExpr{
+					Keys:   []d.Expr{d.LiteralExpr{Value: "a"}, d.VariableExpr{Name: d.NewToken(d.IDENTIFIER, "k", nil, 0)}},
+					Values: []d.Expr{d.LiteralExpr{Value: 1.0}, d.ListExpr{Elements: []d.Expr{}}},
+				},
+			},
+			d.VarStmt{
+				Name:        d.NewToken(d.IDENTIFIER, "e", nil, 0),
+				Initializer: d.MapExpr{Keys: []d.Expr{}, Values: []d.Expr{}},
+			},
+		}
+		for i, expected := range expectedStmts {
+			assert.True(util.IsEqualStmt(expected, stmts[i]))
+		}
+
+		_, err = NewSourceParser(lex.NewScanner("var m = {\"a\" 1};")).Parse()
+		assert.Error(err)
+	})
+
+	t.Run("Errors slice assignment", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := NewSourceParser(lex.NewScanner("xs[1:2] = 1;")).Parse()
+		assert.Error(err)
+		_, err = NewSourceParser(lex.NewScanner("[1, 2;")).Parse()
+		assert.Error(err)
+	})
+
+	t.Run("Parses declarations one at a time from a token source", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "var a = 1;\nprint a +;\n{ print a; }\nprint @;\n"
+		parser := NewSourceParser(lex.NewReaderScanner(strings.NewReader(source)))
+
+		st, err := parser.Next()
+		assert.NoError(err)
+		assert.IsType(d.VarStmt{}, st)
+
+		st, err = parser.Next()
+		assert.ErrorAs(err, &ErrSyntax{})
+		assert.Nil(st)
+
+		st, err = parser.Next()
+		assert.NoError(err)
+		assert.IsType(d.BlockStmt{}, st)
+
+		_, err = parser.Next()
+		var errSyntax ErrSyntax
+		assert.ErrorAs(err, &errSyntax)
+		assert.Len(errSyntax.Unwrap(), 1)
+		assert.ErrorAs(errSyntax.Unwrap()[0], &lex.ErrLex{})
+
+		_, err = parser.Next()
+		assert.ErrorIs(err, io.EOF)
+	})
+
+	t.Run("Reports only the scan error for rejected source", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, source := range []string{"print @;", "print 1 @ 2;", "var a = #;"} {
+			stmts, err := NewSourceParser(lex.NewScanner(source + "\nprint 1;")).Parse()
+
+			var errSyntax ErrSyntax
+			assert.ErrorAs(err, &errSyntax, source)
+			assert.Len(errSyntax.Unwrap(), 1, source)
+			assert.ErrorAs(errSyntax.Unwrap()[0], &lex.ErrLex{}, source)
+			assert.Len(stmts, 1, source)
+		}
+	})
+
+	t.Run("Parses a program from a token source", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := strings.Repeat("print 1 == 1;\n", 1000)
+		stmts, err := NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(err)
+		assert.Len(stmts, 1000)
+	})
 }
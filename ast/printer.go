@@ -4,6 +4,7 @@ import (
 	d "example/compilers/domain"
 	"example/compilers/util"
 	"fmt"
+	"strings"
 )
 
 type AstPrinter struct{}
@@ -75,6 +76,57 @@ func (p *AstPrinter) VisitCallExpr(expr d.CallExpr) (interface{}, error) {
 	return fmt.Sprintf("CALL{%s, %s, %s}", callee, expr.Paren.Lexeme, p.parenthesize("", expr.Args...)), nil
 }
 
+func (p *AstPrinter) VisitInterpolationExpr(expr d.InterpolationExpr) (interface{}, error) {
+	return p.parenthesize("interpolate", expr.Parts...), nil
+}
+
+func (p *AstPrinter) VisitLambdaExpr(expr d.LambdaExpr) (interface{}, error) {
+	params := make([]string, 0, len(expr.Params)+1)
+	for i, param := range expr.Params {
+		if i < len(expr.Defaults) && expr.Defaults[i] != nil {
+			params = append(params, fmt.Sprintf("%s = %s", param.Lexeme, p.Print(expr.Defaults[i])))
+			continue
+		}
+		params = append(params, param.Lexeme)
+	}
+	if expr.Rest != nil {
+		params = append(params, "..."+expr.Rest.Lexeme)
+	}
+	return fmt.Sprintf("LAMBDA{%s}", strings.Join(params, ", ")), nil
+}
+
+func (p *AstPrinter) VisitListExpr(expr d.ListExpr) (interface{}, error) {
+	return p.parenthesize("list", expr.Elements...), nil
+}
+
+func (p *AstPrinter) VisitIndexExpr(expr d.IndexExpr) (interface{}, error) {
+	return p.parenthesize("index", expr.Object, expr.Index), nil
+}
+
+func (p *AstPrinter) VisitIndexSetExpr(expr d.IndexSetExpr) (interface{}, error) {
+	return p.parenthesize("index-set", expr.Object, expr.Index, expr.Value), nil
+}
+
+func (p *AstPrinter) VisitSliceExpr(expr d.SliceExpr) (interface{}, error) {
+	return p.parenthesize("slice", expr.Object, orNil(expr.Start), orNil(expr.End)), nil
+}
+
+func (p *AstPrinter) VisitMapExpr(expr d.MapExpr) (interface{}, error) {
+	entries := make([]d.Expr, 0, len(expr.Keys)*2)
+	for i := range expr.Keys {
+		entries = append(entries, expr.Keys[i], expr.Values[i])
+	}
+	return p.parenthesize("map", entries...), nil
+}
+
+// orNil stands a nil literal in for a left out expression.
+func orNil(expr d.Expr) d.Expr {
+	if expr == nil {
+		return d.LiteralExpr{Value: nil}
+	}
+	return expr
+}
+
 func (p *AstPrinter) VisitVariableExpr(expr d.VariableExpr) (interface{}, error) {
 	return fmt.Sprintf("VAR{%s}", expr.Name.Lexeme), nil
 }
@@ -25,18 +25,30 @@ func main() {
 		"This     : Keyword *Token",
 		"Grouping : Expression Expr",
 		"Variable : Name *Token",
+		"Interpolation : Parts []Expr",
+		"Lambda   : Keyword *Token, Params []*Token, Defaults []Expr, Rest *Token, Body []Stmt",
+		"List     : Bracket *Token, Elements []Expr",
+		"Index    : Object Expr, Bracket *Token, Index Expr",
+		"IndexSet : Object Expr, Bracket *Token, Index Expr, Value Expr",
+		"Slice    : Object Expr, Bracket *Token, Start Expr, End Expr",
+		"Map      : Brace *Token, Keys []Expr, Values []Expr",
 	}, true)
 
 	writeAst("Stmt", []string{
 		"Block      : Stmts []Stmt",
+		"Break      : Keyword *Token, Label *Token",
 		"Class      : Name *Token, SuperClass *VariableExpr, Methods []FunctionStmt",
+		"Continue   : Keyword *Token, Label *Token",
 		"Expression : Expression Expr",
-		"Function   : Name *Token, Params []*Token, Body []Stmt",
+		"ForIn      : Keyword *Token, Vars []*Token, Iterable Expr, Body Stmt, Label *Token",
+		"Function   : Name *Token, Params []*Token, Defaults []Expr, Rest *Token, Body []Stmt",
 		"If         : Condition Expr, ThenBranch Stmt, ElseBranch Stmt",
 		"Print      : Expression Expr",
 		"Return     : Keyword *Token, Value Expr",
+		"Throw      : Keyword *Token, Value Expr",
+		"Try        : Keyword *Token, Body []Stmt, CatchName *Token, Catch []Stmt, Finally []Stmt",
 		"Var        : Name *Token, Initializer Expr",
-		"While      : Condition Expr, Body Stmt",
+		"While      : Condition Expr, Body Stmt, Increment Expr, Label *Token",
 	}, false)
 }
 
@@ -74,6 +86,7 @@ func defineInterface(name string, hasReturnValue bool) string {
 	return fmt.Sprintf(`
 type %s interface {
 	Accept(visitor %sVisitor) %s
+	GetSpan() Span
 }
 `, name, name, getReturnType(hasReturnValue))
 }
@@ -88,6 +101,8 @@ func defineTypes(name string, types []string, hasReturnValue bool) (str string)
 		for _, field := range fields {
 			str += fmt.Sprintf("\t%s\n", strings.Trim(field, " "))
 		}
+		// Every node records the source it was parsed from
+		str += "\tSpan Span\n"
 
 		str += "}\n"
 
@@ -95,7 +110,11 @@ func defineTypes(name string, types []string, hasReturnValue bool) (str string)
 func (b %s) Accept(visitor %sVisitor) %s {
 	return visitor.Visit%s(b)
 }
-`, fullTypeName, name, getReturnType(hasReturnValue), fullTypeName)
+
+func (b %s) GetSpan() Span {
+	return b.Span
+}
+`, fullTypeName, name, getReturnType(hasReturnValue), fullTypeName, fullTypeName)
 	}
 	return str
 }
@@ -0,0 +1,201 @@
+package diag
+
+import (
+	"errors"
+	d "example/compilers/domain"
+	"fmt"
+	"strings"
+)
+
+// Errors from the scanner, parser, resolver and interpreter all point at a
+// place in the source through these methods.
+type sourceError interface {
+	error
+	Message() string
+	Span() d.Span
+}
+
+type noter interface {
+	Notes() []string
+}
+
+type hinter interface {
+	Hints() []string
+}
+
+type Diagnostic struct {
+	Message string
+	Span    d.Span
+	Notes   []string
+	Hints   []string
+}
+
+// HasSpan reports whether the diagnostic points at real source.
+func (diag Diagnostic) HasSpan() bool {
+	return diag.Span.Start.Line > 0
+}
+
+// Collect flattens an error into one diagnostic per underlying error.
+func Collect(err error) []Diagnostic {
+	if err == nil {
+		return nil
+	}
+
+	if multi, ok := err.(interface{ Unwrap() []error }); ok {
+		diags := make([]Diagnostic, 0)
+		for _, e := range multi.Unwrap() {
+			diags = append(diags, Collect(e)...)
+		}
+		return diags
+	}
+
+	diag := Diagnostic{Message: err.Error()}
+
+	var srcErr sourceError
+	if errors.As(err, &srcErr) {
+		diag.Message = srcErr.Message()
+		diag.Span = srcErr.Span()
+	}
+
+	var n noter
+	if errors.As(err, &n) {
+		diag.Notes = n.Notes()
+	}
+
+	var h hinter
+	if errors.As(err, &h) {
+		diag.Hints = h.Hints()
+	}
+
+	return []Diagnostic{diag}
+}
+
+type Mode int
+
+const (
+	Plain Mode = iota
+	Color
+)
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[1;31m"
+	ansiBlue  = "\x1b[1;34m"
+	ansiCyan  = "\x1b[1;36m"
+)
+
+// Renderer formats diagnostics against a source file, rustc style:
+//
+//	error: Expect ';' after value.
+//	 --> example.lox:1:8
+//	  |
+//	1 | print 1
+//	  |        ^
+type Renderer struct {
+	filename string
+	lines    []string
+	mode     Mode
+}
+
+func NewRenderer(filename string, source string, mode Mode) *Renderer {
+	return &Renderer{
+		filename: filename,
+		lines:    strings.Split(source, "\n"),
+		mode:     mode,
+	}
+}
+
+// Render formats every diagnostic contained in err.
+func (r *Renderer) Render(err error) string {
+	var sb strings.Builder
+	for i, diag := range Collect(err) {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(r.RenderDiagnostic(diag))
+	}
+	return sb.String()
+}
+
+func (r *Renderer) RenderDiagnostic(diag Diagnostic) string {
+	var sb strings.Builder
+
+	sb.WriteString(r.paint(ansiRed, "error"))
+	sb.WriteString(r.paint(ansiBold, ": "+diag.Message))
+	sb.WriteString("\n")
+
+	if !diag.HasSpan() {
+		sb.WriteString(fmt.Sprintf("%s %s\n", r.paint(ansiBlue, "-->"), r.filename))
+		r.writeFooter(&sb, diag, "")
+		return sb.String()
+	}
+
+	start := diag.Span.Start
+	gutter := strings.Repeat(" ", len(fmt.Sprint(start.Line)))
+	sb.WriteString(fmt.Sprintf("%s%s %s:%d:%d\n", gutter, r.paint(ansiBlue, "-->"), r.filename, start.Line, start.Column))
+
+	if start.Line > len(r.lines) {
+		r.writeFooter(&sb, diag, gutter)
+		return sb.String()
+	}
+
+	line := strings.TrimRight(r.lines[start.Line-1], "\r")
+	sb.WriteString(fmt.Sprintf("%s %s\n", gutter, r.paint(ansiBlue, "|")))
+	sb.WriteString(fmt.Sprintf("%s %s %s\n", r.paint(ansiBlue, fmt.Sprint(start.Line)), r.paint(ansiBlue, "|"), line))
+	sb.WriteString(fmt.Sprintf("%s %s %s%s\n", gutter, r.paint(ansiBlue, "|"), padding(line, start.Column), r.paint(ansiRed, carets(line, diag.Span))))
+
+	r.writeFooter(&sb, diag, gutter)
+	return sb.String()
+}
+
+func (r *Renderer) writeFooter(sb *strings.Builder, diag Diagnostic, gutter string) {
+	for _, note := range diag.Notes {
+		sb.WriteString(fmt.Sprintf("%s %s %s\n", gutter, r.paint(ansiBlue, "="), r.paint(ansiBold, "note: ")+note))
+	}
+	for _, hint := range diag.Hints {
+		sb.WriteString(fmt.Sprintf("%s %s %s\n", gutter, r.paint(ansiBlue, "="), r.paint(ansiCyan, "help: ")+hint))
+	}
+}
+
+func (r *Renderer) paint(code string, s string) string {
+	if r.mode != Color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// padding lines the caret up with the given column, keeping any tabs from
+// the source line so it renders at the same width.
+func padding(line string, column int) string {
+	var sb strings.Builder
+	col := 1
+	for _, c := range line {
+		if col >= column {
+			break
+		}
+		if c == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+		col++
+	}
+	for ; col < column; col++ {
+		sb.WriteRune(' ')
+	}
+	return sb.String()
+}
+
+// carets underlines the span, stopping at the end of the line for spans
+// covering several lines.
+func carets(line string, span d.Span) string {
+	width := span.End.Column - span.Start.Column
+	if span.End.Line != span.Start.Line {
+		width = len([]rune(line)) - span.Start.Column + 1
+	}
+	if width < 1 {
+		width = 1
+	}
+	return strings.Repeat("^", width)
+}
@@ -0,0 +1,84 @@
+package diag
+
+import (
+	"errors"
+	"example/compilers/ast"
+	"example/compilers/lex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	t.Run("Renders parse error with caret", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "var a = 1;\nprint a +;\n"
+		tokens, err := lex.NewScanner(source).Scan()
+		assert.NoError(err)
+		_, err = ast.NewParser(tokens).Parse()
+		assert.Error(err)
+
+		expected := strings.Join([]string{
+			"error: Expected expression.",
+			" --> test.lox:2:10",
+			"  |",
+			"2 | print a +;",
+			"  |          ^",
+			"",
+		}, "\n")
+		assert.Equal(expected, NewRenderer("test.lox", source, Plain).Render(err))
+	})
+
+	t.Run("Renders every scan error with hints", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "var a = @;\nvar b = \"abc;"
+		_, err := lex.NewScanner(source).Scan()
+		assert.Error(err)
+
+		diags := Collect(err)
+		assert.Len(diags, 2)
+		assert.Equal("unexpected character: '@'", diags[0].Message)
+		assert.Equal(1, diags[0].Span.Start.Line)
+		assert.Equal("unterminated string", diags[1].Message)
+		assert.Equal(2, diags[1].Span.Start.Line)
+
+		expected := strings.Join([]string{
+			"error: unterminated string",
+			" --> test.lox:2:9",
+			"  |",
+			"2 | var b = \"abc;",
+			"  |         ^^^^^",
+			"  = help: add a closing '\"' to end the string",
+			"",
+		}, "\n")
+		assert.Equal(expected, NewRenderer("test.lox", source, Plain).RenderDiagnostic(diags[1]))
+	})
+
+	t.Run("Keeps tabs when lining up carets", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "\tprint @;"
+		_, err := lex.NewScanner(source).Scan()
+		assert.Error(err)
+
+		rendered := NewRenderer("test.lox", source, Plain).Render(err)
+		assert.Contains(rendered, "  | \t      ^\n")
+	})
+
+	t.Run("Renders errors without a location", func(t *testing.T) {
+		assert := assert.New(t)
+
+		rendered := NewRenderer("test.lox", "", Plain).Render(errors.New("boom"))
+		assert.Equal("error: boom\n--> test.lox\n", rendered)
+	})
+
+	t.Run("Colors output", func(t *testing.T) {
+		assert := assert.New(t)
+
+		rendered := NewRenderer("test.lox", "", Color).Render(errors.New("boom"))
+		assert.Contains(rendered, ansiRed+"error"+ansiReset)
+	})
+}
@@ -5,22 +5,57 @@ import (
 )
 
 var Keywords = map[string]TokenType{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"for":    FOR,
-	"fun":    FUN,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"while":  WHILE,
+	"and":      AND,
+	"break":    BREAK,
+	"catch":    CATCH,
+	"class":    CLASS,
+	"continue": CONTINUE,
+	"else":     ELSE,
+	"false":    FALSE,
+	"finally":  FINALLY,
+	"for":      FOR,
+	"fun":      FUN,
+	"if":       IF,
+	"in":       IN,
+	"nil":      NIL,
+	"or":       OR,
+	"print":    PRINT,
+	"return":   RETURN,
+	"super":    SUPER,
+	"this":     THIS,
+	"throw":    THROW,
+	"true":     TRUE,
+	"try":      TRY,
+	"var":      VAR,
+	"while":    WHILE,
+}
+
+// Position is a single point in the source. Line and Column are 1-based,
+// Offset is the 0-based byte offset from the start of the source.
+type Position struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span is the half-open range of source [Start, End) covered by a token or
+// an AST node.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// Join returns the span from the start of s to the end of o.
+func (s Span) Join(o Span) Span {
+	return Span{Start: s.Start, End: o.End}
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%s-%s", s.Start, s.End)
 }
 
 type Token struct {
@@ -28,6 +63,30 @@ type Token struct {
 	Lexeme  string
 	Literal interface{}
 	Line    int
+	Span    Span
+
+	// Doc holds the '///' doc comment lines written directly before the token
+	Doc string
+
+	// Whitespace and comments around the token, only kept when scanning in
+	// lossless mode
+	LeadingTrivia  []Trivia
+	TrailingTrivia []Trivia
+}
+
+type TriviaKind int
+
+const (
+	TRIVIA_WHITESPACE TriviaKind = iota
+	TRIVIA_NEWLINE
+	TRIVIA_LINE_COMMENT
+	TRIVIA_DOC_COMMENT
+	TRIVIA_BLOCK_COMMENT
+)
+
+type Trivia struct {
+	Kind TriviaKind
+	Text string
 }
 
 func NewToken(kind TokenType, lexeme string, literal interface{}, line int) *Token {
@@ -39,10 +98,36 @@ func NewToken(kind TokenType, lexeme string, literal interface{}, line int) *Tok
 	}
 }
 
+func NewTokenAt(kind TokenType, lexeme string, literal interface{}, span Span) *Token {
+	return &Token{
+		Kind:    kind,
+		Lexeme:  lexeme,
+		Literal: literal,
+		Line:    span.Start.Line,
+		Span:    span,
+	}
+}
+
 func (t Token) String() string {
 	return fmt.Sprintf("%s %s %v", t.Kind, t.Lexeme, t.Literal)
 }
 
+// Where describes the token for use in error messages, e.g. "at 'foo'".
+func (t *Token) Where() string {
+	if t == nil || t.Kind == EOF {
+		return "at end"
+	}
+	return fmt.Sprintf("at '%s'", t.Lexeme)
+}
+
+// SpanOf returns the span of a possibly nil token.
+func SpanOf(t *Token) Span {
+	if t == nil {
+		return Span{}
+	}
+	return t.Span
+}
+
 type TokenType int
 
 const (
@@ -51,8 +136,11 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 	COMMA
 	DOT
+	COLON
 	MINUS
 	PLUS
 	SEMICOLON
@@ -68,30 +156,43 @@ const (
 	GREATER_EQUAL
 	LESS
 	LESS_EQUAL
+	ARROW
+	ELLIPSIS
 
 	// Literals.
 	IDENTIFIER
 	STRING
 	NUMBER
+	// A string segment ending in "${", followed by the embedded expression
+	INTERPOLATION
 
 	// Keywords.
 	AND
+	BREAK
+	CATCH
 	CLASS
+	CONTINUE
 	ELSE
 	FALSE
+	FINALLY
 	FUN
 	FOR
 	IF
+	IN
 	NIL
 	OR
 	PRINT
 	RETURN
 	SUPER
 	THIS
+	THROW
 	TRUE
+	TRY
 	VAR
 	WHILE
 
+	// Stands in for source the scanner rejected, so the parser can skip it.
+	ERROR
 	EOF
 )
 
@@ -114,10 +215,16 @@ func (t TokenType) String() string {
 		return "LEFT_BRACE"
 	case RIGHT_BRACE:
 		return "RIGHT_BRACE"
+	case LEFT_BRACKET:
+		return "LEFT_BRACKET"
+	case RIGHT_BRACKET:
+		return "RIGHT_BRACKET"
 	case COMMA:
 		return "COMMA"
 	case DOT:
 		return "DOT"
+	case COLON:
+		return "COLON"
 	case MINUS:
 		return "MINUS"
 	case PLUS:
@@ -144,26 +251,42 @@ func (t TokenType) String() string {
 		return "LESS"
 	case LESS_EQUAL:
 		return "LESS_EQUAL"
+	case ARROW:
+		return "ARROW"
+	case ELLIPSIS:
+		return "ELLIPSIS"
 	case IDENTIFIER:
 		return "IDENTIFIER"
 	case STRING:
 		return "STRING"
 	case NUMBER:
 		return "NUMBER"
+	case INTERPOLATION:
+		return "INTERPOLATION"
 	case AND:
 		return "AND"
+	case BREAK:
+		return "BREAK"
+	case CATCH:
+		return "CATCH"
 	case CLASS:
 		return "CLASS"
+	case CONTINUE:
+		return "CONTINUE"
 	case ELSE:
 		return "ELSE"
 	case FALSE:
 		return "FALSE"
+	case FINALLY:
+		return "FINALLY"
 	case FUN:
 		return "FUN"
 	case FOR:
 		return "FOR"
 	case IF:
 		return "IF"
+	case IN:
+		return "IN"
 	case NIL:
 		return "NIL"
 	case OR:
@@ -176,12 +299,18 @@ func (t TokenType) String() string {
 		return "SUPER"
 	case THIS:
 		return "THIS"
+	case THROW:
+		return "THROW"
 	case TRUE:
 		return "TRUE"
+	case TRY:
+		return "TRY"
 	case VAR:
 		return "VAR"
 	case WHILE:
 		return "WHILE"
+	case ERROR:
+		return "ERROR"
 	case EOF:
 		return "EOF"
 	default:
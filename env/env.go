@@ -40,6 +40,19 @@ func (e *Environment) Get(name *d.Token) (interface{}, error) {
 	return nil, fmt.Errorf("env value '%s' not found", name.Lexeme) // TODO: runtime err?
 }
 
+// Lookup is Get by plain name, for hosts that have no token to hand.
+func (e *Environment) Lookup(name string) (interface{}, bool) {
+	if v, ok := e.values[name]; ok {
+		return v, true
+	}
+
+	if e.enclosing != nil {
+		return e.enclosing.Lookup(name)
+	}
+
+	return nil, false
+}
+
 func (e *Environment) GetAt(distance int, name string) (interface{}, error) {
 	return e.ancestor(distance).values[name], nil
 }
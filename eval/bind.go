@@ -0,0 +1,446 @@
+package eval
+
+import (
+	d "example/compilers/domain"
+	"example/compilers/util"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// GoClass is a Go struct type bound with DefineStruct. Calling it makes a
+// zero value of the struct.
+type GoClass struct {
+	name string
+	typ  reflect.Type
+	in   *Interpreter
+}
+
+var _ Callable = (*GoClass)(nil)
+
+func (c *GoClass) String() string {
+	return c.name
+}
+
+func (c *GoClass) Arity() Arity {
+	return Exactly(0)
+}
+
+func (c *GoClass) Call(in *Interpreter, args []interface{}) (interface{}, error) {
+	if err := in.allocate(1); err != nil {
+		return nil, err
+	}
+	return &GoObject{class: c, v: reflect.New(c.typ)}, nil
+}
+
+// GoObject is a pointer to a Go struct. Scripts read and write its
+// exported fields and call its exported methods by their Go names, with
+// values converted as described on ToValue.
+type GoObject struct {
+	class *GoClass
+	v     reflect.Value
+}
+
+// Interface gives the pointer to the struct.
+func (o *GoObject) Interface() interface{} {
+	return o.v.Interface()
+}
+
+func (o *GoObject) String() string {
+	if stringer, ok := o.v.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return o.class.name + " instance"
+}
+
+func (o *GoObject) Get(name *d.Token) (interface{}, error) {
+	if field, ok := o.field(name.Lexeme); ok {
+		// Nested structs stay part of this one, so setting their fields
+		// works
+		if field.Kind() == reflect.Struct {
+			field = field.Addr()
+		}
+		v, err := toValue(o.class.in, field)
+		if err != nil {
+			return nil, locate(name, err)
+		}
+		return v, nil
+	}
+
+	if method := o.v.MethodByName(name.Lexeme); method.IsValid() {
+		return bindMethod(name.Lexeme, method), nil
+	}
+
+	return nil, newErrClass(name, fmt.Sprintf("Undefined property '%s'", name.Lexeme))
+}
+
+func (o *GoObject) Set(name *d.Token, value interface{}) error {
+	field, ok := o.field(name.Lexeme)
+	if !ok {
+		return newErrClass(name, fmt.Sprintf("Undefined field '%s'", name.Lexeme))
+	}
+
+	v, err := fromValue(value, field.Type())
+	if err != nil {
+		return locate(name, err)
+	}
+	field.Set(v)
+	return nil
+}
+
+// field finds an exported field, including those of embedded structs.
+func (o *GoObject) field(name string) (reflect.Value, bool) {
+	sf, ok := o.class.typ.FieldByName(name)
+	if !ok || !sf.IsExported() {
+		return reflect.Value{}, false
+	}
+
+	field, err := o.v.Elem().FieldByIndexErr(sf.Index)
+	if err != nil {
+		return reflect.Value{}, false
+	}
+	return field, true
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// bindMethod wraps a Go method as a native. A trailing error result is
+// raised when set, and any other result is returned.
+func bindMethod(name string, method reflect.Value) *nativeFn {
+	typ := method.Type()
+	arity := Exactly(typ.NumIn())
+	if typ.IsVariadic() {
+		arity = Arity{Min: typ.NumIn() - 1, Max: Variadic}
+	}
+
+	return newNativeFnArity(name, arity, func(in *Interpreter, args []interface{}) (interface{}, error) {
+		goArgs := make([]reflect.Value, len(args))
+		for j, arg := range args {
+			argType := typ.In(min(j, typ.NumIn()-1))
+			if typ.IsVariadic() && j >= typ.NumIn()-1 {
+				argType = argType.Elem()
+			}
+
+			v, err := fromValue(arg, argType)
+			if err != nil {
+				return nil, nativeErrorf("argument %d of '%s': %s", j+1, name, err)
+			}
+			goArgs[j] = v
+		}
+
+		results, err := callMethod(method, goArgs)
+		if err != nil {
+			return nil, nativeErrorf("'%s' panicked: %v", name, err)
+		}
+		if n := len(results); n > 0 && typ.Out(n-1) == errorType {
+			if err, _ := results[n-1].Interface().(error); err != nil {
+				return nil, errNative{message: err.Error(), cause: err}
+			}
+			results = results[:n-1]
+		}
+
+		switch len(results) {
+		case 0:
+			return nil, nil
+		case 1:
+			return toValue(in, results[0])
+		}
+		return nil, nativeErrorf("can't call method '%s' returning %d results", name, len(results))
+	})
+}
+
+// callMethod calls method, recovering from a panic so that scripts can
+// catch it like any error from a native.
+func callMethod(method reflect.Value, args []reflect.Value) (results []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return method.Call(args), nil
+}
+
+// DefineStruct binds the struct type of v, which may also be a pointer to
+// one, as the global class name.
+func (i *Interpreter) DefineStruct(name string, v interface{}) error {
+	typ := reflect.TypeOf(v)
+	if typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return fmt.Errorf("can't define '%s': %v is not a struct", name, typ)
+	}
+
+	class := &GoClass{name: name, typ: typ, in: i}
+	i.goClasses[typ] = class
+	i.globals.Define(name, class)
+	return nil
+}
+
+// ToValue converts a Go value for a script. Numbers become float64, slices
+// and arrays become lists, and maps become maps. Structs and pointers to
+// them become objects of the class defined for their type, or of a class
+// named after the type. Lox values pass through unchanged.
+func (i *Interpreter) ToValue(v interface{}) (Value, error) {
+	converted, err := toValue(i, reflect.ValueOf(v))
+	if nErr, ok := err.(errNative); ok {
+		return nil, fmt.Errorf("%s", nErr.message)
+	}
+	return converted, err
+}
+
+func toValue(in *Interpreter, v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.CanInterface() {
+		switch lv := v.Interface().(type) {
+		case *List, *Map, *Instance, *GoObject, *ErrorObject, *Range, *Module, Callable:
+			return lv, nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toValue(in, v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		if err := in.allocate(1 + v.Len()); err != nil {
+			return nil, err
+		}
+		elements := make([]interface{}, v.Len())
+		for j := range elements {
+			element, err := toValue(in, v.Index(j))
+			if err != nil {
+				return nil, err
+			}
+			elements[j] = element
+		}
+		return NewList(elements), nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if err := in.allocate(1 + v.Len()); err != nil {
+			return nil, err
+		}
+		m := NewMap()
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := toValue(in, iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			value, err := toValue(in, iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			if err := m.SetAt(key, value); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Elem().Kind() == reflect.Struct {
+			return &GoObject{class: in.goClass(v.Type().Elem()), v: v}, nil
+		}
+		return toValue(in, v.Elem())
+	case reflect.Struct:
+		// Scripts get a copy, since they can't change the original anyway
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		return &GoObject{class: in.goClass(v.Type()), v: ptr}, nil
+	}
+
+	return nil, nativeErrorf("can't convert Go %s to a Lox value", v.Type())
+}
+
+// goClass finds the class for a struct type, naming one after the type if
+// it wasn't defined.
+func (i *Interpreter) goClass(typ reflect.Type) *GoClass {
+	if class, ok := i.goClasses[typ]; ok {
+		return class
+	}
+
+	class := &GoClass{name: typ.Name(), typ: typ, in: i}
+	i.goClasses[typ] = class
+	return class
+}
+
+// fromValue converts a script value to the Go type typ, the reverse of
+// toValue. Numbers must fit integer types exactly.
+func fromValue(v interface{}, typ reflect.Type) (reflect.Value, error) {
+	if obj, ok := v.(*GoObject); ok {
+		switch {
+		case obj.v.Type().AssignableTo(typ):
+			return obj.v, nil
+		case obj.v.Type().Elem().AssignableTo(typ):
+			return obj.v.Elem(), nil
+		}
+	}
+
+	switch typ.Kind() {
+	case reflect.Interface:
+		if v == nil {
+			return reflect.Zero(typ), nil
+		}
+		goIface, err := toGo(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		goV := reflect.ValueOf(goIface)
+		if goV.Type().AssignableTo(typ) {
+			return goV, nil
+		}
+	case reflect.Bool:
+		if b, ok := v.(bool); ok {
+			return reflect.ValueOf(b).Convert(typ), nil
+		}
+	case reflect.String:
+		if s, ok := v.(string); ok {
+			return reflect.ValueOf(s).Convert(typ), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := v.(float64); ok {
+			return reflect.ValueOf(n).Convert(typ), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := v.(float64); ok {
+			goV := reflect.New(typ).Elem()
+			if n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 || goV.OverflowInt(int64(n)) {
+				return reflect.Value{}, nativeErrorf("%s doesn't fit in %s", util.ToString(n), typ)
+			}
+			goV.SetInt(int64(n))
+			return goV, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := v.(float64); ok {
+			goV := reflect.New(typ).Elem()
+			if n != math.Trunc(n) || n < 0 || n >= math.MaxUint64 || goV.OverflowUint(uint64(n)) {
+				return reflect.Value{}, nativeErrorf("%s doesn't fit in %s", util.ToString(n), typ)
+			}
+			goV.SetUint(uint64(n))
+			return goV, nil
+		}
+	case reflect.Slice:
+		if v == nil {
+			return reflect.Zero(typ), nil
+		}
+		if l, ok := v.(*List); ok {
+			goV := reflect.MakeSlice(typ, l.Len(), l.Len())
+			for j, element := range l.elements {
+				converted, err := fromValue(element, typ.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				goV.Index(j).Set(converted)
+			}
+			return goV, nil
+		}
+	case reflect.Array:
+		if l, ok := v.(*List); ok && l.Len() == typ.Len() {
+			goV := reflect.New(typ).Elem()
+			for j, element := range l.elements {
+				converted, err := fromValue(element, typ.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				goV.Index(j).Set(converted)
+			}
+			return goV, nil
+		}
+	case reflect.Map:
+		if v == nil {
+			return reflect.Zero(typ), nil
+		}
+		if m, ok := v.(*Map); ok {
+			goV := reflect.MakeMapWithSize(typ, m.Len())
+			for _, key := range m.keys {
+				goKey, err := fromValue(key, typ.Key())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				goValue, err := fromValue(m.values[key], typ.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				goV.SetMapIndex(goKey, goValue)
+			}
+			return goV, nil
+		}
+	case reflect.Pointer:
+		if v == nil {
+			return reflect.Zero(typ), nil
+		}
+	}
+
+	return reflect.Value{}, nativeErrorf("can't convert '%s' to Go %s", util.ToString(v), typ)
+}
+
+// toGo picks the Go value for a script value bound to an interface type:
+// lists become []interface{} and maps map[interface{}]interface{}. A list
+// or map containing itself has no such value.
+func toGo(v interface{}) (interface{}, error) {
+	return toGoSeen(v, make(map[interface{}]bool))
+}
+
+// toGoSeen is toGo, with seen holding the lists and maps being converted
+// further up.
+func toGoSeen(v interface{}, seen map[interface{}]bool) (interface{}, error) {
+	switch lv := v.(type) {
+	case *GoObject:
+		return lv.Interface(), nil
+	case *List:
+		if seen[lv] {
+			return nil, nativeErrorf("can't convert a list containing itself to Go")
+		}
+		seen[lv] = true
+		defer delete(seen, lv)
+
+		elements := make([]interface{}, lv.Len())
+		for j, element := range lv.elements {
+			goV, err := toGoSeen(element, seen)
+			if err != nil {
+				return nil, err
+			}
+			elements[j] = goV
+		}
+		return elements, nil
+	case *Map:
+		if seen[lv] {
+			return nil, nativeErrorf("can't convert a map containing itself to Go")
+		}
+		seen[lv] = true
+		defer delete(seen, lv)
+
+		m := make(map[interface{}]interface{}, lv.Len())
+		for _, key := range lv.keys {
+			// Keys are never lists or maps, so they stay as they are
+			goV, err := toGoSeen(lv.values[key], seen)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = goV
+		}
+		return m, nil
+	}
+	return v, nil
+}
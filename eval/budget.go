@@ -0,0 +1,176 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	d "example/compilers/domain"
+	"fmt"
+	"time"
+)
+
+// The budget errors stop a script from outside, so unlike runtime errors a
+// try statement can't catch them.
+
+// ErrStepLimit is returned once a script executes more statements than
+// WithMaxSteps allows.
+type ErrStepLimit struct {
+	Limit int64
+	span  d.Span
+}
+
+func (e ErrStepLimit) Error() string {
+	return fmt.Sprintf("%s: %s", e.span.Start, e.Message())
+}
+
+func (e ErrStepLimit) Message() string {
+	return fmt.Sprintf("step limit of %d exceeded", e.Limit)
+}
+
+func (e ErrStepLimit) Span() d.Span {
+	return e.span
+}
+
+// ErrAllocLimit is returned once a script allocates more than
+// WithMaxAllocations allows.
+type ErrAllocLimit struct {
+	Limit int64
+	span  d.Span
+}
+
+func (e ErrAllocLimit) Error() string {
+	return fmt.Sprintf("%s: %s", e.span.Start, e.Message())
+}
+
+func (e ErrAllocLimit) Message() string {
+	return fmt.Sprintf("allocation limit of %d exceeded", e.Limit)
+}
+
+func (e ErrAllocLimit) Span() d.Span {
+	return e.span
+}
+
+// ErrTimeout is returned once a script runs for longer than WithTimeout
+// allows.
+type ErrTimeout struct {
+	Limit time.Duration
+	span  d.Span
+}
+
+func (e ErrTimeout) Error() string {
+	return fmt.Sprintf("%s: %s", e.span.Start, e.Message())
+}
+
+func (e ErrTimeout) Message() string {
+	return fmt.Sprintf("time limit of %s exceeded", e.Limit)
+}
+
+func (e ErrTimeout) Span() d.Span {
+	return e.span
+}
+
+// ErrCanceled is returned once the context passed to InterpretContext is
+// done. It unwraps to the context's error.
+type ErrCanceled struct {
+	cause error
+	span  d.Span
+}
+
+func (e ErrCanceled) Error() string {
+	return fmt.Sprintf("%s: %s", e.span.Start, e.Message())
+}
+
+func (e ErrCanceled) Message() string {
+	return fmt.Sprintf("interrupted: %s", e.cause)
+}
+
+func (e ErrCanceled) Span() d.Span {
+	return e.span
+}
+
+func (e ErrCanceled) Unwrap() error {
+	return e.cause
+}
+
+// isBudget reports whether err stopped the script from outside. Like
+// signals, try statements don't catch these.
+func isBudget(err error) bool {
+	return errors.As(err, &ErrStepLimit{}) ||
+		errors.As(err, &ErrAllocLimit{}) ||
+		errors.As(err, &ErrTimeout{}) ||
+		errors.As(err, &ErrCanceled{})
+}
+
+// The clock and context are looked at on the first tick and then only
+// every so many, keeping the cost per statement, expression and call down.
+const checkInterval = 256
+
+// budget tracks one run of InterpretContext against the limits.
+type budget struct {
+	ctx      context.Context
+	deadline time.Time
+
+	steps       int64
+	ticks       int64
+	allocations int64
+	// The statement being run, where a limit error is reported
+	current d.Span
+}
+
+// startBudget begins a run, unless one is already going.
+func (i *Interpreter) startBudget(ctx context.Context) {
+	i.running++
+	if i.running > 1 {
+		return
+	}
+
+	i.budget = budget{ctx: ctx}
+	if i.timeout > 0 {
+		i.budget.deadline = time.Now().Add(i.timeout)
+	}
+}
+
+func (i *Interpreter) stopBudget() {
+	i.running--
+}
+
+// step counts one statement about to run at span.
+func (i *Interpreter) step(span d.Span) error {
+	i.budget.current = span
+	i.budget.steps++
+	if i.maxSteps > 0 && i.budget.steps > i.maxSteps {
+		return ErrStepLimit{Limit: i.maxSteps, span: span}
+	}
+	return i.tick(span)
+}
+
+// tick checks the context and the deadline before a statement, an
+// expression or a call at span, so that neither a long expression nor a
+// deep recursion outruns them.
+func (i *Interpreter) tick(span d.Span) error {
+	i.budget.ticks++
+	if i.budget.ticks%checkInterval != 1 {
+		return nil
+	}
+	if err := i.budget.ctx.Err(); err != nil {
+		return ErrCanceled{cause: context.Cause(i.budget.ctx), span: span}
+	}
+	if !i.budget.deadline.IsZero() && time.Now().After(i.budget.deadline) {
+		return ErrTimeout{Limit: i.timeout, span: span}
+	}
+	return nil
+}
+
+// allocate counts n units of memory made by the current statement: one per
+// new value, plus one per element of a list or map and one per byte of a
+// string.
+func (i *Interpreter) allocate(n int) error {
+	// The host converting values between runs isn't limited
+	if i.running == 0 {
+		return nil
+	}
+	i.budget.allocations += int64(n)
+	if i.maxAllocations > 0 && i.budget.allocations > i.maxAllocations {
+		return ErrAllocLimit{Limit: i.maxAllocations, span: i.budget.current}
+	}
+	return nil
+}
@@ -4,19 +4,49 @@ import (
 	d "example/compilers/domain"
 	"example/compilers/env"
 	"fmt"
+	"strconv"
 	"time"
 )
 
 type Callable interface {
-	Arity() int
+	Arity() Arity
 	Call(in *Interpreter, args []interface{}) (interface{}, error)
 }
 
+// Arity is the range of argument counts a callable accepts, with Max
+// Variadic when there is no upper bound.
+type Arity struct {
+	Min int
+	Max int
+}
+
+const Variadic = -1
+
+func Exactly(n int) Arity {
+	return Arity{Min: n, Max: n}
+}
+
+func (a Arity) Accepts(n int) bool {
+	return n >= a.Min && (a.Max == Variadic || n <= a.Max)
+}
+
+func (a Arity) String() string {
+	switch {
+	case a.Max == Variadic:
+		return fmt.Sprintf("at least %d", a.Min)
+	case a.Min == a.Max:
+		return strconv.Itoa(a.Min)
+	}
+	return fmt.Sprintf("%d to %d", a.Min, a.Max)
+}
+
 type Func struct {
 	declaration d.FunctionStmt
 	closure     *env.Environment
 
 	isInitializer bool
+	// Set for methods, to name them in stack traces
+	className string
 }
 
 func newFunc(declaration d.FunctionStmt, closure *env.Environment, isInitializer bool) Func {
@@ -29,41 +59,53 @@ func newFunc(declaration d.FunctionStmt, closure *env.Environment, isInitializer
 
 var _ Callable = (*Func)(nil)
 
-func (f Func) Arity() int {
-	return len(f.declaration.Params)
+// Arity counts the params up to the first with a default as required.
+func (f Func) Arity() Arity {
+	arity := Exactly(len(f.declaration.Params))
+	for i, def := range f.declaration.Defaults {
+		if def != nil {
+			arity.Min = i
+			break
+		}
+	}
+	if f.declaration.Rest != nil {
+		arity.Max = Variadic
+	}
+	return arity
 }
 
-func (f Func) Call(in *Interpreter, args []interface{}) (returnVal interface{}, retErr error) {
-	defer func() {
-		if err := recover(); err != nil {
-			if v, ok := err.(ReturnVal); ok {
-				if f.isInitializer {
-					v, err := f.closure.GetAt(0, "this")
-					if err != nil {
-						retErr = err
-						return
-					}
-
-					returnVal = v
-					return
-				}
-
-				returnVal = v.Value
-				return
-			}
+func (f Func) Call(in *Interpreter, args []interface{}) (interface{}, error) {
+	fnEnv := env.NewEnv(f.closure)
 
-			panic(err)
+	params := f.declaration.Params
+	for i, param := range params {
+		if i < len(args) {
+			fnEnv.Define(param.Lexeme, args[i])
+			continue
 		}
-	}()
 
-	fnEnv := env.NewEnv(f.closure)
+		// Missing args have defaults, evaluated afresh on every call
+		v, err := in.evaluateIn(f.declaration.Defaults[i], fnEnv)
+		if err != nil {
+			return nil, err
+		}
+		fnEnv.Define(param.Lexeme, v)
+	}
 
-	for i := range f.Arity() {
-		fnEnv.Define(f.declaration.Params[i].Lexeme, args[i])
+	if f.declaration.Rest != nil {
+		rest := make([]interface{}, 0)
+		if len(args) > len(params) {
+			rest = append(rest, args[len(params):]...)
+		}
+		if err := in.allocate(1 + len(rest)); err != nil {
+			return nil, err
+		}
+		fnEnv.Define(f.declaration.Rest.Lexeme, NewList(rest))
 	}
 
 	err := in.executeBlock(f.declaration.Body, fnEnv)
-	if err != nil {
+	returned, isReturn := err.(ReturnVal)
+	if err != nil && !isReturn {
 		return nil, err
 	}
 
@@ -71,25 +113,34 @@ func (f Func) Call(in *Interpreter, args []interface{}) (returnVal interface{},
 		return f.closure.GetAt(0, "this")
 	}
 
-	return nil, nil
+	return returned.Value, nil
 }
 
-func (f Func) Bind(instance Instance) Func {
+func (f Func) Bind(instance *Instance) Func {
 	e := env.NewEnv(f.closure)
 	e.Define("this", instance)
-	return newFunc(f.declaration, e, f.isInitializer)
+	bound := newFunc(f.declaration, e, f.isInitializer)
+	bound.className = f.className
+	return bound
+}
+
+func (f Func) name() string {
+	if f.declaration.Name == nil {
+		return "anonymous"
+	}
+	return f.declaration.Name.Lexeme
 }
 
 func (f Func) String() string {
-	return fmt.Sprintf("<fn %s>", f.declaration.Name.Lexeme)
+	return fmt.Sprintf("<fn %s>", f.name())
 }
 
 type ClockCallable struct{}
 
 var _ Callable = (*ClockCallable)(nil)
 
-func (cb ClockCallable) Arity() int {
-	return 0
+func (cb ClockCallable) Arity() Arity {
+	return Exactly(0)
 }
 
 func (cb ClockCallable) Call(in *Interpreter, args []interface{}) (interface{}, error) {
@@ -106,15 +157,18 @@ type InputCallable struct{}
 
 var _ Callable = (*InputCallable)(nil)
 
-func (cb InputCallable) Arity() int {
-	return 1
+func (cb InputCallable) Arity() Arity {
+	return Exactly(1)
 }
 
 func (cb InputCallable) Call(in *Interpreter, args []interface{}) (interface{}, error) {
-	fmt.Println(args[0])
+	_, err := fmt.Fprintln(in.stdout, args[0])
+	if err != nil {
+		return nil, err
+	}
 
 	var ret string
-	_, err := fmt.Scan(&ret)
+	_, err = fmt.Fscan(in.stdin, &ret)
 	if err != nil {
 		return nil, err
 	}
@@ -11,7 +11,15 @@ type ErrClass struct {
 }
 
 func (e ErrClass) Error() string {
-	return fmt.Sprintf("%s %s", e.message, e.token)
+	return fmt.Sprintf("%s: %s (%s)", d.SpanOf(e.token).Start, e.message, e.token.Where())
+}
+
+func (e ErrClass) Message() string {
+	return e.message
+}
+
+func (e ErrClass) Span() d.Span {
+	return d.SpanOf(e.token)
 }
 
 func newErrClass(t *d.Token, msg string) ErrClass {
@@ -42,22 +50,28 @@ func (c *Class) String() string {
 }
 
 func (c *Class) Call(in *Interpreter, args []interface{}) (interface{}, error) {
+	if err := in.allocate(1); err != nil {
+		return nil, err
+	}
 	instance := NewInstance(c)
 
 	initializer := c.FindMethod("init")
 	if initializer != nil {
-		initializer.Bind(instance).Call(in, args)
+		_, err := initializer.Bind(instance).Call(in, args)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return instance, nil
 }
 
-func (c *Class) Arity() int {
+func (c *Class) Arity() Arity {
 	initializer := c.FindMethod("init")
 	if initializer != nil {
 		return initializer.Arity()
 	}
-	return 0
+	return Exactly(0)
 }
 
 func (c *Class) FindMethod(name string) *Func {
@@ -72,14 +86,16 @@ func (c *Class) FindMethod(name string) *Func {
 	return nil
 }
 
+// Instance is shared by reference, so two instances are only equal, and only
+// the same map key, when they are the same object.
 type Instance struct {
 	Clazz *Class
 
 	fields map[string]interface{}
 }
 
-func NewInstance(clazz *Class) Instance {
-	return Instance{
+func NewInstance(clazz *Class) *Instance {
+	return &Instance{
 		Clazz:  clazz,
 		fields: make(map[string]interface{}),
 	}
@@ -96,7 +112,7 @@ func (i *Instance) Get(name *d.Token) (interface{}, error) {
 
 	method := i.Clazz.FindMethod(name.Lexeme)
 	if method != nil {
-		return method.Bind(*i), nil
+		return method.Bind(i), nil
 	}
 
 	return nil, newErrClass(name, fmt.Sprintf("Undefined property '%s'", name.Lexeme))
@@ -0,0 +1,88 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	d "example/compilers/domain"
+	"fmt"
+	"reflect"
+)
+
+// Value is a Lox value as a host sees it: nil, bool, float64, string,
+// *List, *Map, *Instance or a Callable. Where the host passes values in,
+// as to SetGlobal and Call or from a NativeFunc, it may also pass any Go
+// value ToValue accepts, such as an int or a []string.
+type Value = interface{}
+
+// NativeFunc implements a function defined with DefineNative. Arity is
+// checked before it is called, and its result is converted with ToValue.
+type NativeFunc func(args []Value) (Value, error)
+
+// DefineNative makes fn callable from scripts as the global name. An error
+// it returns is raised at the call like any runtime error, so scripts can
+// catch it, and hosts can still find it with errors.Is and errors.As.
+func (i *Interpreter) DefineNative(name string, arity int, fn NativeFunc) {
+	i.DefineNativeArity(name, Exactly(arity), fn)
+}
+
+// DefineNativeArity is DefineNative for a function taking optional or
+// variadic args.
+func (i *Interpreter) DefineNativeArity(name string, arity Arity, fn NativeFunc) {
+	i.globals.Define(name, newNativeFnArity(name, arity, func(in *Interpreter, args []interface{}) (interface{}, error) {
+		v, err := fn(args)
+		if err == nil {
+			return toValue(in, reflect.ValueOf(v))
+		}
+
+		// Errors from calling back into Lox already say where they happened
+		var srcErr interface{ Span() d.Span }
+		if errors.As(err, &srcErr) {
+			return nil, err
+		}
+		return nil, errNative{message: err.Error(), cause: err}
+	}))
+}
+
+// SetGlobal defines, or redefines, the global name as v converted with
+// ToValue.
+func (i *Interpreter) SetGlobal(name string, v Value) error {
+	converted, err := i.ToValue(v)
+	if err != nil {
+		return fmt.Errorf("can't set '%s': %w", name, err)
+	}
+	i.globals.Define(name, converted)
+	return nil
+}
+
+// GetGlobal reads the global name, with ok false if it isn't defined.
+func (i *Interpreter) GetGlobal(name string) (v Value, ok bool) {
+	return i.globals.Lookup(name)
+}
+
+// Call calls a Lox function or class, such as one read with GetGlobal,
+// with args converted with ToValue.
+func (i *Interpreter) Call(fn Value, args ...Value) (Value, error) {
+	return i.CallContext(context.Background(), fn, args...)
+}
+
+// CallContext is Call with a budget, like InterpretContext. Called from a
+// native while a script runs, it shares the budget of that run instead.
+func (i *Interpreter) CallContext(ctx context.Context, fn Value, args ...Value) (Value, error) {
+	i.startBudget(ctx)
+	defer i.stopBudget()
+
+	converted := make([]interface{}, len(args))
+	for j, arg := range args {
+		v, err := i.ToValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", j+1, err)
+		}
+		converted[j] = v
+	}
+
+	v, err := callback(i, fn, converted...)
+	if err != nil {
+		return nil, i.withTrace(err)
+	}
+	return v, nil
+}
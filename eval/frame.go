@@ -0,0 +1,162 @@
+package eval
+
+import (
+	"errors"
+	d "example/compilers/domain"
+	"fmt"
+)
+
+// Frame is one active call, pushed by call for as long as the callee runs.
+type Frame struct {
+	Function string
+	// Class is set for methods and initializers
+	Class string
+	// Call is the closing paren of the call site
+	Call *d.Token
+}
+
+func (f Frame) Name() string {
+	if f.Class != "" {
+		return f.Class + "." + f.Function
+	}
+	return f.Function
+}
+
+// ErrRuntime wraps a runtime error with the frames that were active when it
+// was raised.
+type ErrRuntime struct {
+	err      error
+	frames   []Frame
+	fileName string
+}
+
+func (e ErrRuntime) Error() string {
+	return e.err.Error()
+}
+
+func (e ErrRuntime) Unwrap() error {
+	return e.err
+}
+
+func (e ErrRuntime) Frames() []Frame {
+	return e.frames
+}
+
+// Trace lists the frames innermost first, each as "at foo (file.lox:12)".
+func (e ErrRuntime) Trace() []string {
+	return formatTrace(e.fileName, e.frames, errorSpan(e.err))
+}
+
+// Notes lets diagnostics show the trace under the error.
+func (e ErrRuntime) Notes() []string {
+	return e.Trace()
+}
+
+// errorSpan finds where an error was raised, if it says.
+func errorSpan(err error) d.Span {
+	var srcErr interface{ Span() d.Span }
+	if errors.As(err, &srcErr) {
+		return srcErr.Span()
+	}
+	return d.Span{}
+}
+
+// Traces longer than this, say after a stack overflow, keep only their ends.
+const maxTraceLines = 30
+
+// formatTrace places each frame at the call it was making, and the
+// innermost one at span.
+func formatTrace(fileName string, frames []Frame, span d.Span) []string {
+	trace := make([]string, 0, len(frames)+1)
+	for k := len(frames) - 1; k >= -1; k-- {
+		name := "<script>"
+		if k >= 0 {
+			name = frames[k].Name()
+		}
+
+		at := span
+		if k+1 < len(frames) {
+			at = d.SpanOf(frames[k+1].Call)
+		}
+
+		trace = append(trace, fmt.Sprintf("at %s (%s)", name, location(fileName, at)))
+	}
+
+	if len(trace) > maxTraceLines {
+		keep := maxTraceLines / 2
+		elided := fmt.Sprintf("... %d more frames", len(trace)-2*keep)
+		trace = append(append(trace[:keep:keep], elided), trace[len(trace)-keep:]...)
+	}
+	return trace
+}
+
+func location(fileName string, span d.Span) string {
+	if fileName == "" {
+		if span.Start.Line == 0 {
+			return "unknown"
+		}
+		return fmt.Sprintf("line %d", span.Start.Line)
+	}
+	if span.Start.Line == 0 {
+		return fileName
+	}
+	return fmt.Sprintf("%s:%d", fileName, span.Start.Line)
+}
+
+// call calls cb in a new frame, checking the call depth first. at is the
+// closing paren of the call site, or nil for a call from the host.
+func (i *Interpreter) call(cb Callable, args []interface{}, at *d.Token) (interface{}, error) {
+	if err := i.tick(d.SpanOf(at)); err != nil {
+		return nil, err
+	}
+	frame := frameOf(cb, at)
+	if i.maxCallDepth > 0 && len(i.frames) >= i.maxCallDepth {
+		return nil, i.withTrace(newErrInterpret(at, fmt.Sprintf("Stack overflow calling '%s'.", frame.Name())))
+	}
+
+	i.frames = append(i.frames, frame)
+	v, err := cb.Call(i, args)
+	if err != nil {
+		err = i.withTrace(locate(at, err))
+	}
+	i.frames = i.frames[:len(i.frames)-1]
+
+	return v, err
+}
+
+// withTrace wraps err with the current frames unless an inner call already
+// did.
+func (i *Interpreter) withTrace(err error) error {
+	if errors.As(err, &ErrRuntime{}) {
+		return err
+	}
+
+	frames := make([]Frame, len(i.frames))
+	copy(frames, i.frames)
+	return ErrRuntime{
+		err:      err,
+		frames:   frames,
+		fileName: i.fileName,
+	}
+}
+
+// frameOf names the frame for calling cb.
+func frameOf(cb Callable, call *d.Token) Frame {
+	frame := Frame{Function: "<native>", Call: call}
+	switch fn := cb.(type) {
+	case Func:
+		frame.Function = fn.name()
+		frame.Class = fn.className
+	case *Class:
+		frame.Function = "init"
+		frame.Class = fn.name
+	case *GoClass:
+		frame.Function = "new"
+		frame.Class = fn.name
+	case *nativeFn:
+		frame.Function = fn.name
+	case fmt.Stringer:
+		frame.Function = fn.String()
+	}
+	return frame
+}
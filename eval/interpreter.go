@@ -1,20 +1,40 @@
 package eval
 
 import (
+	"bufio"
+	"context"
 	d "example/compilers/domain"
 	"example/compilers/env"
 	"example/compilers/util"
 	"fmt"
+	"io"
+	"os"
 	"reflect"
+	"strings"
+	"time"
 )
 
 type ErrInterpret struct {
 	message string
 	token   *d.Token
+	cause   error
 }
 
 func (e ErrInterpret) Error() string {
-	return fmt.Sprintf("%s %s", e.message, e.token)
+	return fmt.Sprintf("%s: %s (%s)", d.SpanOf(e.token).Start, e.message, e.token.Where())
+}
+
+func (e ErrInterpret) Message() string {
+	return e.message
+}
+
+func (e ErrInterpret) Span() d.Span {
+	return d.SpanOf(e.token)
+}
+
+// Unwrap gives the error returned by a native defined with DefineNative.
+func (e ErrInterpret) Unwrap() error {
+	return e.cause
 }
 
 func newErrInterpret(t *d.Token, msg string) ErrInterpret {
@@ -30,30 +50,154 @@ type Interpreter struct {
 
 	env     *env.Environment
 	globals *env.Environment
-	locals  map[d.Expr]int
+	// Scopes out to each local, by the token naming it where it's used.
+	// Exprs can't be the keys, as some of them hold slices.
+	locals map[*d.Token]int
+
+	// Calls in progress, outermost first
+	frames []Frame
+	// Calls nested deeper than this fail with a stack overflow, unless it
+	// is 0
+	maxCallDepth int
+	// Shown in stack traces
+	fileName string
+
+	// Classes for the Go structs scripts have seen
+	goClasses map[reflect.Type]*GoClass
+
+	// Where print writes and input reads
+	stdout io.Writer
+	stdin  io.Reader
+
+	// Nested runs, as when a native calls back into Lox, share the budget
+	// of the outermost
+	running int
+
+	// Limits on a single run, each 0 for no limit
+	maxSteps       int64
+	maxAllocations int64
+	timeout        time.Duration
+	budget         budget
+}
+
+// DefaultMaxCallDepth keeps runaway recursion well clear of the Go stack
+// limit.
+const DefaultMaxCallDepth = 1024
+
+type Option func(*Interpreter)
+
+// WithFileName names the script in stack traces.
+func WithFileName(fileName string) Option {
+	return func(i *Interpreter) {
+		i.fileName = fileName
+	}
+}
+
+// WithMaxCallDepth limits how deeply calls may nest, 0 meaning no limit.
+func WithMaxCallDepth(depth int) Option {
+	return func(i *Interpreter) {
+		i.maxCallDepth = depth
+	}
+}
+
+// WithMaxSteps limits how many statements a run may execute.
+func WithMaxSteps(steps int64) Option {
+	return func(i *Interpreter) {
+		i.maxSteps = steps
+	}
 }
 
-func NewInterpreter() *Interpreter {
+// WithMaxAllocations limits how much memory a run may take. Every list,
+// map, instance, function and string it creates counts 1, plus 1 for every
+// element added to a list or map and 1 for every byte of a string.
+func WithMaxAllocations(allocations int64) Option {
+	return func(i *Interpreter) {
+		i.maxAllocations = allocations
+	}
+}
+
+// WithTimeout limits how long a run may take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(i *Interpreter) {
+		i.timeout = timeout
+	}
+}
+
+// WithStdout sends the output of print statements and input prompts to w.
+// There is no option for stderr: the interpreter never writes errors itself
+// but returns them, and the host decides where they go.
+func WithStdout(w io.Writer) Option {
+	return func(i *Interpreter) {
+		i.stdout = w
+	}
+}
+
+// WithStdin makes input read from r. Unless r can unread runes it gets
+// buffered, so pass a *bufio.Reader to share r between interpreters.
+func WithStdin(r io.Reader) Option {
+	return func(i *Interpreter) {
+		if _, ok := r.(io.RuneScanner); !ok {
+			r = bufio.NewReader(r)
+		}
+		i.stdin = r
+	}
+}
+
+// stdin is shared by all interpreters reading os.Stdin, so that none of
+// them buffers input another one should have read.
+var stdin = bufio.NewReader(os.Stdin)
+
+func NewInterpreter(opts ...Option) *Interpreter {
 	globals := env.NewEnv(nil)
 	globals.Define("clock", ClockCallable{})
 	globals.Define("input", InputCallable{})
+	globals.Define("range", rangeFn)
+	globals.Define("Error", errorFn)
+	globals.Define("math", newMathModule())
+	globals.Define("str", strFn)
+	globals.Define("num", numFn)
 
-	return &Interpreter{
+	i := &Interpreter{
 		env:     globals,
 		globals: globals,
-		locals:  make(map[d.Expr]int),
+		locals:  make(map[*d.Token]int),
+		frames:  make([]Frame, 0),
+		budget:  budget{ctx: context.Background()},
+		stdout:  os.Stdout,
+		stdin:   stdin,
+
+		goClasses: make(map[reflect.Type]*GoClass),
+
+		maxCallDepth: DefaultMaxCallDepth,
 	}
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
 }
 
-func (i *Interpreter) Resolve(expr d.Expr, depth int) {
-	i.locals[expr] = depth
+// Resolve records that the variable, this or super named by name is a local
+// depth scopes out from where it's used.
+func (i *Interpreter) Resolve(name *d.Token, depth int) {
+	i.locals[name] = depth
 }
 
 func (i *Interpreter) Interpret(stmts []d.Stmt) error {
+	return i.InterpretContext(context.Background(), stmts)
+}
+
+// InterpretContext runs stmts until they finish or ctx is done, returning
+// ErrCanceled in the latter case. Each call gets a fresh budget for the
+// limits set by WithMaxSteps, WithMaxAllocations and WithTimeout.
+func (i *Interpreter) InterpretContext(ctx context.Context, stmts []d.Stmt) error {
+	i.startBudget(ctx)
+	defer i.stopBudget()
+
 	for _, s := range stmts {
 		err := i.execute(s)
 		if err != nil {
-			return err
+			return i.withTrace(err)
 		}
 	}
 
@@ -61,6 +205,9 @@ func (i *Interpreter) Interpret(stmts []d.Stmt) error {
 }
 
 func (i *Interpreter) execute(s d.Stmt) error {
+	if err := i.step(s.GetSpan()); err != nil {
+		return err
+	}
 	return s.Accept(i)
 }
 
@@ -96,7 +243,9 @@ func (i *Interpreter) VisitClassStmt(s d.ClassStmt) error {
 
 	methods := make(map[string]Func)
 	for _, method := range s.Methods {
-		methods[method.Name.Lexeme] = newFunc(method, i.env, method.Name.Lexeme == "init")
+		fn := newFunc(method, i.env, method.Name.Lexeme == "init")
+		fn.className = s.Name.Lexeme
+		methods[method.Name.Lexeme] = fn
 	}
 
 	klass := newClass(s.Name.Lexeme, superclass, methods)
@@ -110,18 +259,18 @@ func (i *Interpreter) VisitClassStmt(s d.ClassStmt) error {
 }
 
 func (i *Interpreter) VisitSuperExpr(expr d.SuperExpr) (interface{}, error) {
-	distance := i.locals[expr]
+	distance := i.locals[expr.Keyword]
 	superclassRaw, err := i.env.GetAt(distance, "super")
 	if err != nil {
 		return nil, err
 	}
-	superclass := superclassRaw.(Class)
+	superclass := superclassRaw.(*Class)
 
 	instanceRaw, err := i.env.GetAt(distance-1, "this")
 	if err != nil {
 		return nil, err
 	}
-	instance := instanceRaw.(Instance)
+	instance := instanceRaw.(*Instance)
 
 	method := superclass.FindMethod(expr.Method.Lexeme)
 
@@ -133,12 +282,29 @@ func (i *Interpreter) VisitSuperExpr(expr d.SuperExpr) (interface{}, error) {
 }
 
 func (i *Interpreter) VisitFunctionStmt(s d.FunctionStmt) error {
+	if err := i.allocate(1); err != nil {
+		return err
+	}
 	fn := newFunc(s, i.env, false)
 	i.env.Define(s.Name.Lexeme, fn)
 
 	return nil
 }
 
+func (i *Interpreter) VisitLambdaExpr(e d.LambdaExpr) (interface{}, error) {
+	if err := i.allocate(1); err != nil {
+		return nil, err
+	}
+	declaration := d.FunctionStmt{
+		Params:   e.Params,
+		Defaults: e.Defaults,
+		Rest:     e.Rest,
+		Body:     e.Body,
+		Span:     e.Span,
+	}
+	return newFunc(declaration, i.env, false), nil
+}
+
 func (i *Interpreter) VisitIfStmt(s d.IfStmt) error {
 	condition, err := i.evaluate(s.Condition)
 	if err != nil {
@@ -166,27 +332,148 @@ func (i *Interpreter) VisitWhileStmt(s d.WhileStmt) error {
 			return nil
 		}
 
-		err = i.execute(s.Body)
+		broke, err := i.executeLoopBody(s.Body, s.Label)
 		if err != nil {
 			return err
 		}
+		if broke {
+			return nil
+		}
+
+		if s.Increment != nil {
+			_, err = i.evaluate(s.Increment)
+			if err != nil {
+				return err
+			}
+		}
 	}
 }
 
-func (i *Interpreter) VisitPrintStmt(s d.PrintStmt) error {
-	v, err := i.evaluate(s.Expression)
+func (i *Interpreter) VisitForInStmt(s d.ForInStmt) error {
+	iterable, err := i.evaluate(s.Iterable)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(util.ToString(v))
-	return nil
+	next, err := i.iterator(iterable, len(s.Vars), s.Keyword)
+	if err != nil {
+		return locate(s.Keyword, err)
+	}
+
+	for {
+		values, ok, err := next()
+		if err != nil {
+			return locate(s.Keyword, err)
+		}
+		if !ok {
+			return nil
+		}
+
+		broke, err := i.executeIteration(s, values)
+		if err != nil {
+			return err
+		}
+		if broke {
+			return nil
+		}
+	}
 }
 
+// executeIteration runs the body of a for-in loop in a fresh environment
+// holding the loop variables, so closures capture each step's values.
+func (i *Interpreter) executeIteration(s d.ForInStmt, values []interface{}) (bool, error) {
+	previousEnv := i.env
+	defer func() {
+		i.env = previousEnv
+	}()
+
+	i.env = env.NewEnv(previousEnv)
+	for j, v := range s.Vars {
+		i.env.Define(v.Lexeme, values[j])
+	}
+
+	return i.executeLoopBody(s.Body, s.Label)
+}
+
+// Return, break and continue are returned as errors by their statements,
+// unwinding every enclosing statement up to the call or loop they target.
+// The resolver makes sure they always have one, so they never reach the
+// caller of Interpret.
 type ReturnVal struct {
 	Value interface{}
 }
 
+func (ReturnVal) Error() string {
+	return "return outside of a function"
+}
+
+// A nil Label targets the innermost loop.
+type BreakSignal struct {
+	Label *d.Token
+}
+
+func (BreakSignal) Error() string {
+	return "break outside of a loop"
+}
+
+type ContinueSignal struct {
+	Label *d.Token
+}
+
+func (ContinueSignal) Error() string {
+	return "continue outside of a loop"
+}
+
+// isSignal tells control flow apart from errors, which try statements
+// catch.
+func isSignal(err error) bool {
+	switch err.(type) {
+	case ReturnVal, BreakSignal, ContinueSignal:
+		return true
+	}
+	return false
+}
+
+// executeLoopBody runs one iteration, stopping the break and continue
+// signals aimed at the loop with the given label.
+func (i *Interpreter) executeLoopBody(body d.Stmt, label *d.Token) (broke bool, err error) {
+	err = i.execute(body)
+	switch signal := err.(type) {
+	case BreakSignal:
+		if targetsLoop(signal.Label, label) {
+			return true, nil
+		}
+	case ContinueSignal:
+		if targetsLoop(signal.Label, label) {
+			return false, nil
+		}
+	}
+
+	return false, err
+}
+
+func targetsLoop(target *d.Token, label *d.Token) bool {
+	return target == nil || (label != nil && target.Lexeme == label.Lexeme)
+}
+
+func (i *Interpreter) VisitBreakStmt(s d.BreakStmt) error {
+	return BreakSignal{Label: s.Label}
+}
+
+func (i *Interpreter) VisitContinueStmt(s d.ContinueStmt) error {
+	return ContinueSignal{Label: s.Label}
+}
+
+func (i *Interpreter) VisitPrintStmt(s d.PrintStmt) error {
+	v, err := i.evaluate(s.Expression)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(i.stdout, util.ToString(v))
+	return err
+}
+
 func (i *Interpreter) VisitReturnStmt(s d.ReturnStmt) error {
 	var value interface{}
 	if s.Value != nil {
@@ -197,9 +484,40 @@ func (i *Interpreter) VisitReturnStmt(s d.ReturnStmt) error {
 		}
 	}
 
-	// I don't like this but it's the easiest way to unwrap the
-	// call stack to get back to the caller...
-	panic(ReturnVal{Value: value})
+	return ReturnVal{Value: value}
+}
+
+func (i *Interpreter) VisitThrowStmt(s d.ThrowStmt) error {
+	value, err := i.evaluate(s.Value)
+	if err != nil {
+		return err
+	}
+
+	if errObj, ok := value.(*ErrorObject); ok {
+		errObj.locate(s.Keyword.Span, formatTrace(i.fileName, i.frames, s.Keyword.Span))
+	}
+
+	return ErrThrow{value: value, token: s.Keyword}
+}
+
+func (i *Interpreter) VisitTryStmt(s d.TryStmt) error {
+	err := i.executeBlock(s.Body, env.NewEnv(i.env))
+	if err != nil && s.CatchName != nil && !isSignal(err) && !isBudget(err) {
+		catchEnv := env.NewEnv(i.env)
+		catchEnv.Define(s.CatchName.Lexeme, i.caught(err))
+		err = i.executeBlock(s.Catch, catchEnv)
+	}
+
+	if s.Finally != nil {
+		// The finally clause runs however the rest ended, even through a
+		// return, break or continue. If it ends early itself, that wins.
+		finallyErr := i.executeBlock(s.Finally, env.NewEnv(i.env))
+		if finallyErr != nil {
+			return finallyErr
+		}
+	}
+
+	return err
 }
 
 func (i *Interpreter) VisitVarStmt(s d.VarStmt) error {
@@ -276,6 +594,13 @@ func (i *Interpreter) VisitBinaryExpr(e d.BinaryExpr) (interface{}, error) {
 		return nil, err
 	}
 
+	switch e.Operator.Kind {
+	case d.BANG_EQUAL:
+		return !i.isEqual(left, right), nil
+	case d.EQUAL_EQUAL:
+		return i.isEqual(left, right), nil
+	}
+
 	if e.Operator.Kind == d.PLUS {
 		switch l := left.(type) {
 		case float64:
@@ -288,6 +613,9 @@ func (i *Interpreter) VisitBinaryExpr(e d.BinaryExpr) (interface{}, error) {
 		case string:
 			switch r := right.(type) {
 			case string:
+				if err := i.allocate(1 + len(l) + len(r)); err != nil {
+					return nil, err
+				}
 				return l + r, nil
 			default:
 				return nil, newErrInterpret(e.Operator, "expected stringy literal")
@@ -322,10 +650,6 @@ func (i *Interpreter) VisitBinaryExpr(e d.BinaryExpr) (interface{}, error) {
 		return leftVal < rightVal, nil
 	case d.LESS_EQUAL:
 		return leftVal <= rightVal, nil
-	case d.BANG_EQUAL:
-		return !i.isEqual(left, right), nil
-	case d.EQUAL_EQUAL:
-		return i.isEqual(left, right), nil
 	}
 
 	return nil, newErrInterpret(e.Operator, "invalid binary operator")
@@ -352,13 +676,13 @@ func (i *Interpreter) VisitCallExpr(e d.CallExpr) (interface{}, error) {
 		return nil, newErrInterpret(e.Paren, "can only call function/class")
 	}
 
-	if len(args) != cb.Arity() {
+	if !cb.Arity().Accepts(len(args)) {
 		return nil, newErrInterpret(
 			e.Paren,
-			fmt.Sprintf("expected %d args but got %d instead.", len(args), cb.Arity()))
+			fmt.Sprintf("expected %s args but got %d instead.", cb.Arity(), len(args)))
 	}
 
-	return cb.Call(i, args)
+	return i.call(cb, args, e.Paren)
 }
 
 func (i *Interpreter) VisitGetExpr(e d.GetExpr) (interface{}, error) {
@@ -367,8 +691,21 @@ func (i *Interpreter) VisitGetExpr(e d.GetExpr) (interface{}, error) {
 		return nil, err
 	}
 
-	if instance, ok := obj.(Instance); ok {
-		return instance.Get(e.Name)
+	switch o := obj.(type) {
+	case *Instance:
+		return o.Get(e.Name)
+	case *List:
+		return o.Get(e.Name)
+	case *Map:
+		return o.Get(e.Name)
+	case *ErrorObject:
+		return o.Get(e.Name)
+	case *GoObject:
+		return o.Get(e.Name)
+	case *Module:
+		return o.Get(e.Name)
+	case string:
+		return stringMethod(o, e.Name)
 	}
 
 	return nil, newErrInterpret(e.Name, "Only instances have properties")
@@ -380,7 +717,7 @@ func (i *Interpreter) VisitSetExpr(e d.SetExpr) (interface{}, error) {
 		return nil, err
 	}
 
-	if instance, ok := obj.(Instance); ok {
+	if instance, ok := obj.(*Instance); ok {
 		value, err := i.evaluate(e.Value)
 		if err != nil {
 			return nil, err
@@ -390,11 +727,180 @@ func (i *Interpreter) VisitSetExpr(e d.SetExpr) (interface{}, error) {
 		return value, nil
 	}
 
+	if goObject, ok := obj.(*GoObject); ok {
+		value, err := i.evaluate(e.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		err = goObject.Set(e.Name, value)
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+
 	return nil, newErrInterpret(e.Name, "Only instances have fields")
 }
 
+func (i *Interpreter) VisitListExpr(e d.ListExpr) (interface{}, error) {
+	if err := i.allocate(1 + len(e.Elements)); err != nil {
+		return nil, err
+	}
+	elements := make([]interface{}, len(e.Elements))
+	for j, element := range e.Elements {
+		v, err := i.evaluate(element)
+		if err != nil {
+			return nil, err
+		}
+		elements[j] = v
+	}
+	return NewList(elements), nil
+}
+
+func (i *Interpreter) VisitMapExpr(e d.MapExpr) (interface{}, error) {
+	if err := i.allocate(1 + len(e.Keys)); err != nil {
+		return nil, err
+	}
+	m := NewMap()
+	for j := range e.Keys {
+		key, err := i.evaluate(e.Keys[j])
+		if err != nil {
+			return nil, err
+		}
+		value, err := i.evaluate(e.Values[j])
+		if err != nil {
+			return nil, err
+		}
+
+		err = m.SetAt(key, value)
+		if err != nil {
+			return nil, locate(e.Brace, err)
+		}
+	}
+	return m, nil
+}
+
+func (i *Interpreter) VisitIndexExpr(e d.IndexExpr) (interface{}, error) {
+	obj, err := i.evaluate(e.Object)
+	if err != nil {
+		return nil, err
+	}
+	index, err := i.evaluate(e.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+	case *List:
+		v, err := o.At(index)
+		return v, locate(e.Bracket, err)
+	case *Map:
+		v, err := o.At(index)
+		return v, locate(e.Bracket, err)
+	case string:
+		chars := []rune(o)
+		j, err := toIndex(index, len(chars))
+		if err != nil {
+			return nil, locate(e.Bracket, err)
+		}
+		if j < 0 || j >= len(chars) {
+			return nil, newErrInterpret(e.Bracket, fmt.Sprintf("index %s out of range for string of length %d", util.ToString(index), len(chars)))
+		}
+		return string(chars[j]), nil
+	}
+
+	return nil, newErrInterpret(e.Bracket, "Only lists, maps and strings can be indexed")
+}
+
+func (i *Interpreter) VisitIndexSetExpr(e d.IndexSetExpr) (interface{}, error) {
+	obj, err := i.evaluate(e.Object)
+	if err != nil {
+		return nil, err
+	}
+	index, err := i.evaluate(e.Index)
+	if err != nil {
+		return nil, err
+	}
+	value, err := i.evaluate(e.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+	case *List:
+		err = o.SetAt(index, value)
+	case *Map:
+		if has, _ := o.Has(index); !has {
+			if err := i.allocate(1); err != nil {
+				return nil, err
+			}
+		}
+		err = o.SetAt(index, value)
+	default:
+		return nil, newErrInterpret(e.Bracket, "Only lists and maps support index assignment")
+	}
+	if err != nil {
+		return nil, locate(e.Bracket, err)
+	}
+
+	return value, nil
+}
+
+func (i *Interpreter) VisitSliceExpr(e d.SliceExpr) (interface{}, error) {
+	obj, err := i.evaluate(e.Object)
+	if err != nil {
+		return nil, err
+	}
+	var start, end interface{}
+	if e.Start != nil {
+		start, err = i.evaluate(e.Start)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if e.End != nil {
+		end, err = i.evaluate(e.End)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch o := obj.(type) {
+	case *List:
+		v, err := o.Slice(start, end)
+		if err != nil {
+			return nil, locate(e.Bracket, err)
+		}
+		if err := i.allocate(1 + v.Len()); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case string:
+		chars := []rune(o)
+		from, err := toBound(start, len(chars), 0)
+		if err != nil {
+			return nil, locate(e.Bracket, err)
+		}
+		to, err := toBound(end, len(chars), len(chars))
+		if err != nil {
+			return nil, locate(e.Bracket, err)
+		}
+		if from >= to {
+			return "", nil
+		}
+		sub := string(chars[from:to])
+		if err := i.allocate(1 + len(sub)); err != nil {
+			return nil, err
+		}
+		return sub, nil
+	}
+
+	return nil, newErrInterpret(e.Bracket, "Only lists and strings can be sliced")
+}
+
 func (i *Interpreter) VisitThisExpr(e d.ThisExpr) (interface{}, error) {
-	return i.lookUpVariable(e.Keyword, e)
+	return i.lookUpVariable(e.Keyword)
 }
 
 func (i *Interpreter) VisitLogicalExpr(e d.LogicalExpr) (interface{}, error) {
@@ -416,12 +922,27 @@ func (i *Interpreter) VisitLogicalExpr(e d.LogicalExpr) (interface{}, error) {
 	return i.evaluate(e.Right)
 }
 
+func (i *Interpreter) VisitInterpolationExpr(e d.InterpolationExpr) (interface{}, error) {
+	var sb strings.Builder
+	for _, part := range e.Parts {
+		v, err := i.evaluate(part)
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString(util.ToString(v))
+	}
+	if err := i.allocate(1 + sb.Len()); err != nil {
+		return nil, err
+	}
+	return sb.String(), nil
+}
+
 func (i *Interpreter) VisitVariableExpr(e d.VariableExpr) (interface{}, error) {
-	return i.lookUpVariable(e.Name, e)
+	return i.lookUpVariable(e.Name)
 }
 
-func (i *Interpreter) lookUpVariable(name *d.Token, expr d.Expr) (interface{}, error) {
-	distance, ok := i.locals[expr]
+func (i *Interpreter) lookUpVariable(name *d.Token) (interface{}, error) {
+	distance, ok := i.locals[name]
 	if ok {
 		return i.env.GetAt(distance, name.Lexeme)
 	} else {
@@ -435,7 +956,7 @@ func (i *Interpreter) VisitAssignExpr(e d.AssignExpr) (interface{}, error) {
 		return nil, err
 	}
 
-	distance, ok := i.locals[e]
+	distance, ok := i.locals[e.Name]
 	if ok {
 		i.env.AssignAt(distance, e.Name, v)
 	} else {
@@ -446,9 +967,23 @@ func (i *Interpreter) VisitAssignExpr(e d.AssignExpr) (interface{}, error) {
 }
 
 func (i *Interpreter) evaluate(e d.Expr) (interface{}, error) {
+	if err := i.tick(e.GetSpan()); err != nil {
+		return nil, err
+	}
 	return e.Accept(i)
 }
 
+// evaluateIn evaluates e in environment, as for a param default.
+func (i *Interpreter) evaluateIn(e d.Expr, environment *env.Environment) (interface{}, error) {
+	previousEnv := i.env
+	defer func() {
+		i.env = previousEnv
+	}()
+
+	i.env = environment
+	return i.evaluate(e)
+}
+
 func (i *Interpreter) isTruthy(v interface{}) bool {
 	if v == nil {
 		return false
@@ -462,8 +997,59 @@ func (i *Interpreter) isTruthy(v interface{}) bool {
 }
 
 func (i *Interpreter) isEqual(a interface{}, b interface{}) bool {
-	if a == nil {
+	return isEqualValues(a, b, make(map[[2]interface{}]bool))
+}
+
+// isEqualValues compares lists element by element and maps entry by entry,
+// in any order. Instances and Go objects are equal only to themselves,
+// wherever they are nested.
+// comparing holds the pairs of lists and maps already being compared, so
+// one that contains itself is taken as equal on meeting it again instead of
+// recursing forever.
+func isEqualValues(a interface{}, b interface{}, comparing map[[2]interface{}]bool) bool {
+	switch a := a.(type) {
+	case nil:
 		return b == nil
+	case *Instance:
+		return a == b
+	case *GoObject:
+		// Go objects are each a new wrapper, so compare what they point to.
+		// The type tells apart a struct from one at the start of it.
+		goB, ok := b.(*GoObject)
+		return ok && a.v.Type() == goB.v.Type() && a.v.Pointer() == goB.v.Pointer()
+	case *List:
+		l, ok := b.(*List)
+		if !ok || len(a.elements) != len(l.elements) {
+			return false
+		}
+		pair := [2]interface{}{a, l}
+		if comparing[pair] {
+			return true
+		}
+		comparing[pair] = true
+		for j := range a.elements {
+			if !isEqualValues(a.elements[j], l.elements[j], comparing) {
+				return false
+			}
+		}
+		return true
+	case *Map:
+		m, ok := b.(*Map)
+		if !ok || len(a.keys) != len(m.keys) {
+			return false
+		}
+		pair := [2]interface{}{a, m}
+		if comparing[pair] {
+			return true
+		}
+		comparing[pair] = true
+		for _, key := range a.keys {
+			value, ok := m.values[key]
+			if !ok || !isEqualValues(a.values[key], value, comparing) {
+				return false
+			}
+		}
+		return true
 	}
 
 	return reflect.DeepEqual(a, b)
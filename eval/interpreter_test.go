@@ -1,18 +1,26 @@
 package eval_test
 
 import (
+	"bufio"
+	"context"
 	"example/compilers/ast"
 	d "example/compilers/domain"
 	"example/compilers/eval"
+	"example/compilers/lex"
 	"example/compilers/resolve"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func newInterpreter(stmts []d.Stmt) (*eval.Interpreter, error) {
-	interpreter := eval.NewInterpreter()
+func newInterpreter(stmts []d.Stmt, opts ...eval.Option) (*eval.Interpreter, error) {
+	interpreter := eval.NewInterpreter(opts...)
 	err := resolve.NewResolver(interpreter).Resolve(stmts)
 	if err != nil {
 		return nil, err
@@ -20,6 +28,40 @@ func newInterpreter(stmts []d.Stmt) (*eval.Interpreter, error) {
 	return interpreter, nil
 }
 
+// run runs a whole program on interpreter through every stage, the way
+// main does.
+func run(interpreter *eval.Interpreter, source string) error {
+	stmts, err := ast.NewSourceParser(lex.NewScanner(source)).Parse()
+	if err != nil {
+		return err
+	}
+	err = resolve.NewResolver(interpreter).Resolve(stmts)
+	if err != nil {
+		return err
+	}
+	return interpreter.Interpret(stmts)
+}
+
+// interpret runs a whole program on a new interpreter.
+func interpret(source string) error {
+	return run(eval.NewInterpreter(), source)
+}
+
+// output runs a whole program on a new interpreter and gives the lines it
+// printed.
+func output(source string) ([]string, error) {
+	var out strings.Builder
+	err := run(eval.NewInterpreter(eval.WithStdout(&out)), source)
+	return lines(&out), err
+}
+
+func lines(out *strings.Builder) []string {
+	if out.Len() == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
 func TestInterpret(t *testing.T) {
 	type InterpretTestCase struct {
 		expr        d.Expr
@@ -146,6 +188,7 @@ func TestInterpret(t *testing.T) {
 		{oneLTEOne, true},
 		{oneBeqOne, false},
 		{oneEqEqOne, true},
+		{d.InterpolationExpr{Parts: []d.Expr{a, one, nilo, trutho, aPlusB}}, "a1niltrueab"},
 	}
 
 	for _, c := range testCases {
@@ -441,4 +484,1667 @@ func TestInterpret(t *testing.T) {
 			assert.Error(err)
 		})
 	}
+
+	t.Run("Compares instances by identity", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			class Point { init(x) { this.x = x; } }
+			var p1 = Point(1);
+			var p2 = Point(1);
+			print p1 == p1;
+			print p1 == p2;
+
+			class A { name() { return "A"; } }
+			class B < A { name() { return "B" + super.name(); } }
+			print B().name();
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"true", "false", "BA"}, out)
+	})
+
+	t.Run("Raises errors from init", func(t *testing.T) {
+		assert := assert.New(t)
+
+		err := interpret(`
+			class A { init() { nil(); } }
+			A();
+		`)
+		assert.ErrorAs(err, &eval.ErrInterpret{})
+	})
+
+	t.Run("Calls anonymous functions and closures", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			var add = fun (a, b) { return a + b; };
+			print add(1, 2);
+
+			var makeAdder = (n) => (x) => x + n;
+			print makeAdder(10)(5);
+
+			fun apply(f, v) { return f(v); }
+			print apply((x) => { return x * 2; }, 4);
+
+			var count = 0;
+			var inc = () => count = count + 1;
+			inc();
+			inc();
+			print count;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"3", "15", "8", "2"}, out)
+	})
+
+	t.Run("Errors calling a lambda with the wrong arity", func(t *testing.T) {
+		assert := assert.New(t)
+
+		err := interpret("var f = (a) => a; f(1, 2);")
+		assert.Error(err)
+	})
+
+	t.Run("Binds default and rest params", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			fun greet(name, greeting = "hello", punct = greeting == "hello" and "!" or "?") {
+				return "${greeting}, ${name}${punct}";
+			}
+			print greet("ada");
+			print greet("ada", "hi");
+			print greet("ada", "hi", ".");
+
+			// Defaults are evaluated on each call
+			fun append(x, xs = []) { xs.push(x); return xs; }
+			append(1);
+			print append(2);
+
+			fun count(first, ...rest) { return "${first} ${rest}"; }
+			print count(1);
+			print count(1, 2, 3);
+
+			var sum = (...ns) => ns.reduce((a, b) => a + b, 0);
+			print sum();
+			print sum(1, 2, 3);
+
+			class Point {
+				init(x = 0, y = x) { this.x = x; this.y = y; }
+			}
+			var p = Point(3);
+			print "${p.x} ${p.y} ${Point().x}";
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{
+			"hello, ada!", "hi, ada?", "hi, ada.",
+			"[2]",
+			"1 []", "1 [2, 3]",
+			"0", "6",
+			"3 3 0",
+		}, out)
+	})
+
+	t.Run("Errors with the accepted arity range", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var errInterpret eval.ErrInterpret
+		for source, message := range map[string]string{
+			"fun f(a, b) {} f(1);":           "expected 2 args but got 1 instead.",
+			"fun f(a, b = 1) {} f(1, 2, 3);": "expected 1 to 2 args but got 3 instead.",
+			"fun f(a, ...rest) {} f();":      "expected at least 1 args but got 0 instead.",
+			"range();":                       "expected 1 to 3 args but got 0 instead.",
+			"[3, 1].map((a, b) => a);":       "expected a function taking 1 args but it takes 2",
+			"class A { init(a) {} } A();":    "expected 1 args but got 0 instead.",
+			"fun f(a = nil()) {} f();":       "can only call function/class",
+		} {
+			err := interpret(source)
+			assert.ErrorAs(err, &errInterpret, source)
+			assert.Equal(message, errInterpret.Message(), source)
+		}
+	})
+
+	t.Run("Counts ranges in steps", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			fun collect(r) {
+				var xs = [];
+				for (x in r) xs.push(x);
+				return xs;
+			}
+
+			print collect(range(3));
+			print collect(range(1, 3));
+			print collect(range(0, 10, 4));
+			print collect(range(3, 0, -1));
+			print collect(range(0, 3, -1));
+			print range(3, 0, -1);
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"[0, 1, 2]", "[1, 2]", "[0, 4, 8]", "[3, 2, 1]", "[]", "range(3, 0, -1)"}, out)
+
+		var errInterpret eval.ErrInterpret
+		err = interpret("range(0, 1, 0);")
+		assert.ErrorAs(err, &errInterpret)
+		assert.Equal("range step can't be 0", errInterpret.Message())
+		err = interpret(`range(0, "a");`)
+		assert.ErrorAs(err, &errInterpret)
+		assert.Equal("range end must be a number but got 'a'", errInterpret.Message())
+	})
+
+	t.Run("Sorts lists by a comparator", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			var nums = [3, 1, 2];
+			nums.sort((a, b) => a > b);
+			print nums;
+			nums.sort();
+			print nums;
+
+			var pairs = [["b", 2], ["c", 3], ["a", 1]];
+			pairs.sort((a, b) => a[1] < b[1]);
+			print pairs;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"[3, 2, 1]", "[1, 2, 3]", `[["a", 1], ["b", 2], ["c", 3]]`}, out)
+
+		var errThrow eval.ErrThrow
+		err = interpret(`[2, 1].sort((a, b) => { throw "stop"; });`)
+		assert.ErrorAs(err, &errThrow)
+		assert.Equal("stop", errThrow.Value())
+
+		// A failed sort leaves the list as it was
+		out, err = output(`
+			var nums = [3, 1, 4, 1, 5];
+			var calls = 0;
+			try {
+				nums.sort((a, b) => {
+					calls = calls + 1;
+					if (calls > 3) throw "stop";
+					return a < b;
+				});
+			} catch (e) {}
+			print nums;
+			var mixed = [2, "a", 1];
+			try { mixed.sort(); } catch (e) {}
+			print mixed;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"[3, 1, 4, 1, 5]", `[2, "a", 1]`}, out)
+	})
+
+	t.Run("Breaks and continues loops", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			var sum = 0;
+			for (var i = 0; i < 10; i = i + 1) {
+				if (i == 2) continue;
+				if (i == 5) break;
+				sum = sum + i;
+			}
+			print sum;
+
+			var pairs = 0;
+			outer: for (var i = 0; i < 3; i = i + 1) {
+				var j = 0;
+				while (true) {
+					j = j + 1;
+					if (j > i) continue outer;
+					if (i == 2) break outer;
+					pairs = pairs + 1;
+				}
+			}
+			print pairs;
+
+			var n = 0;
+			while (true) {
+				n = n + 1;
+				{ var inner = n; if (inner == 3) break; }
+			}
+			print n;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"8", "1", "3"}, out)
+	})
+
+	t.Run("Indexes, slices and changes lists", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			var xs = [1, 2, 3];
+			print "${xs[0]} ${xs[-1]}";
+			xs[1] = 20;
+			print xs;
+			print xs[1:];
+			print xs[:-1];
+			print xs[5:];
+			print ["a", nil];
+			print "hello"[1] + "hello"[-3:];
+
+			xs.push(4);
+			print xs.len();
+			print xs.pop();
+			xs.insert(0, 0);
+			print xs.remove(1);
+			print xs;
+
+			var alias = xs;
+			alias.push(5);
+			print xs.len();
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{
+			"1 3", "[1, 20, 3]", "[20, 3]", "[1, 20]", "[]", `["a", nil]`, "ello",
+			"4", "4", "1", "[0, 20, 3]",
+			"4",
+		}, out)
+	})
+
+	t.Run("Maps, filters, reduces and sorts lists", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			var xs = [3, 1, 2];
+			print xs.map((x) => x * 2);
+			print xs.filter((x) => x > 1);
+			print xs.reduce((acc, x) => acc + x, 0);
+			xs.sort();
+			print xs;
+
+			var words = ["b", "c", "a"];
+			words.sort();
+			print words;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"[6, 2, 4]", "[3, 2]", "6", "[1, 2, 3]", `["a", "b", "c"]`}, out)
+	})
+
+	// Assignments resolved to a local hold the value, which for some
+	// literals is a slice
+	localLiteralCases := []struct {
+		literal string
+		printed string
+	}{
+		{"1", "1"},
+		{`"a"`, "a"},
+		{"true", "true"},
+		{"nil", "nil"},
+		{"[1, [2]]", "[1, [2]]"},
+		{`{"a": 1}`, `{"a": 1}`},
+		{"(x) => x", "<fn anonymous>"},
+		{"fun (x) {}", "<fn anonymous>"},
+		{`"x${1}"`, "x1"},
+	}
+	for _, c := range localLiteralCases {
+		t.Run(fmt.Sprintf("Assigns %s to a local", c.literal), func(t *testing.T) {
+			assert := assert.New(t)
+
+			out, err := output(fmt.Sprintf(`
+				fun f() { var b; b = %s; print b; }
+				f();
+				{ var c; c = %[1]s; print c; }
+			`, c.literal))
+			assert.NoError(err)
+			assert.Equal([]string{c.printed, c.printed}, out)
+		})
+	}
+
+	t.Run("Prints lists that contain themselves", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			var a = [1];
+			a.push(a);
+			print a;
+			var b = [a, a];
+			print b;
+			print str(a);
+			print "${a}";
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"[1, [...]]", "[[1, [...]], [1, [...]]]", "[1, [...]]", "[1, [...]]"}, out)
+	})
+
+	listErrCases := []string{
+		"[1][1];",
+		"[1][0.5];",
+		"[][\"a\"];",
+		"[].pop();",
+		"[1, \"a\"].sort();",
+		"[1].map(1);",
+		"[1].map((a, b) => a);",
+		"[1].nope;",
+		"1[0];",
+		"var xs = [1]; xs[3] = 1;",
+	}
+	for _, c := range listErrCases {
+		t.Run(fmt.Sprintf("Errors list op: %s", c), func(t *testing.T) {
+			assert := assert.New(t)
+
+			err := interpret(c)
+			assert.Error(err)
+		})
+	}
+
+	t.Run("Prints maps that contain themselves", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			var m = {"a": 1};
+			m["self"] = m;
+			print m;
+			print str(m);
+			print "${m}";
+			print ",".join([m]);
+			var xs = [m];
+			m["xs"] = xs;
+			print xs;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{
+			`{"a": 1, "self": {...}}`, `{"a": 1, "self": {...}}`, `{"a": 1, "self": {...}}`, `{"a": 1, "self": {...}}`,
+			`[{"a": 1, "self": {...}, "xs": [...]}]`,
+		}, out)
+	})
+
+	t.Run("Keys maps by value and instances by identity", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			var m = {"b": 2, "a": 1};
+			m["c"] = 3;
+			m["b"] = 20;
+			print m;
+			print m.len();
+			print m.keys();
+			print m.values();
+			print m.entries()[0];
+			print "${m.delete("a")} ${m.delete("a")}";
+			print "${m.has("a")} ${m.has("c")}";
+
+			var mixed = {1: "one", true: "yes", nil: "none"};
+			print "${mixed[1]} ${mixed[true]} ${mixed[nil]}";
+
+			class Point { init(x) { this.x = x; } }
+			var p1 = Point(1);
+			var p2 = Point(1);
+			var byPoint = {};
+			byPoint[p1] = "first";
+			byPoint[p2] = "second";
+			print "${byPoint.len()} ${byPoint[p1]} ${byPoint[p2]}";
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{
+			`{"b": 20, "a": 1, "c": 3}`, "3", `["b", "a", "c"]`, "[20, 1, 3]", `["b", 20]`,
+			"true false", "false true",
+			"one yes none",
+			"2 first second",
+		}, out)
+	})
+
+	t.Run("Compares lists and maps element by element", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			print [1, [2, "a"]] == [1, [2, "a"]];
+			print [1] == [1, 2];
+			print [nil] == [false];
+			print {"a": 1, "b": [2]} == {"b": [2], "a": 1};
+			print {"a": [1]} == {"a": [2]};
+
+			class P {}
+			var p = P();
+			print [p] == [p];
+			print [P()] == [P()];
+			print {"k": p} == {"k": P()};
+
+			var l1 = [1];
+			l1.push(l1);
+			var l2 = [1];
+			l2.push(l2);
+			print l1 == l2;
+			print l1 == [1, [1]];
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{
+			"true", "false", "false", "true", "false",
+			"true", "false", "false",
+			"true", "false",
+		}, out)
+	})
+
+	mapErrCases := []string{
+		"({})[\"a\"];",
+		"var m = {}; m[[1]] = 1;",
+		"({[]: 1});",
+		"({}).has({});",
+		"({})[0:1];",
+	}
+	for _, c := range mapErrCases {
+		t.Run(fmt.Sprintf("Errors map op: %s", c), func(t *testing.T) {
+			assert := assert.New(t)
+
+			err := interpret(c)
+			assert.ErrorAs(err, &eval.ErrInterpret{})
+		})
+	}
+
+	t.Run("Iterates builtins with for-in", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			var sum = 0;
+			for (x in [1, 2, 3]) sum = sum + x;
+			print sum;
+
+			var indexes = 0;
+			for (i, x in ["a", "b", "c"]) indexes = indexes + i;
+			print indexes;
+
+			var keys = "";
+			var total = 0;
+			var m = {"a": 1, "b": 2};
+			for (k in m) keys = keys + k;
+			for (k, v in m) total = total + v;
+			print "${keys} ${total}";
+
+			var reversed = "";
+			for (c in "héllo") reversed = c + reversed;
+			print reversed;
+
+			var n = 0;
+			for (i in range(0, 10)) {
+				if (i == 3) continue;
+				if (i == 6) break;
+				n = n + i;
+			}
+			print n;
+
+			var fns = [];
+			for (x in [1, 2]) fns.push(() => x);
+			print "${fns[0]()} ${fns[1]()}";
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"6", "3", "ab 3", "olléh", "12", "1 2"}, out)
+	})
+
+	t.Run("Iterates user classes with for-in", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			class Countdown {
+				init(from) { this.from = from; }
+				iterator() { return CountdownIter(this.from); }
+			}
+			class CountdownIter {
+				init(n) { this.n = n; }
+				next() {
+					if (this.n == 0) return nil;
+					this.n = this.n - 1;
+					return this.n + 1;
+				}
+			}
+
+			var seen = [];
+			for (x in Countdown(3)) seen.push(x);
+			print seen;
+
+			class Pairs {
+				init() { this.done = false; }
+				next() {
+					if (this.done) return nil;
+					this.done = true;
+					return ["k", "v"];
+				}
+			}
+			for (k, v in Pairs()) print k + v;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"[3, 2, 1]", "kv"}, out)
+	})
+
+	forInErrCases := []string{
+		"for (x in 1) {}",
+		"for (x in nil) {}",
+		"class A {} for (x in A()) {}",
+		"class A { next() { return 1; } } for (k, v in A()) {}",
+		"class A { iterator() { return 1; } } for (x in A()) {}",
+	}
+	for _, c := range forInErrCases {
+		t.Run(fmt.Sprintf("Errors for-in: %s", c), func(t *testing.T) {
+			assert := assert.New(t)
+
+			err := interpret(c)
+			assert.ErrorAs(err, &eval.ErrInterpret{})
+		})
+	}
+
+	t.Run("Catches thrown values and runtime errors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			var caught;
+			try { throw "boom"; } catch (e) { caught = e; }
+			print caught;
+
+			try {
+				-"a";
+			} catch (e) {
+				caught = e;
+			}
+			print caught.message;
+			print caught.line;
+			print caught.stack;
+
+			class Thing {}
+			try { Thing().missing; } catch (e) { caught = e.message; }
+			print caught;
+
+			try { [].pop(); } catch (e) { caught = e.message; }
+			print caught;
+
+			class MyError { init(code) { this.code = code; } }
+			fun fail() { throw MyError(42); }
+			try { fail(); } catch (e) { caught = e; }
+			print caught.code;
+
+			try { throw Error("bad"); } catch (e) { caught = e; }
+			print "${caught.message} ${caught.line}";
+
+			try {
+				try { throw 1; } catch (e) { throw e + 1; }
+			} catch (e) {
+				caught = e;
+			}
+			print caught;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{
+			"boom",
+			"expected floaty literal", "7", `["at <script> (line 7)"]`,
+			"Undefined property 'missing'",
+			"can't pop from an empty list",
+			"42",
+			"bad 27",
+			"2",
+		}, out)
+	})
+
+	t.Run("Runs finally clauses", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			var log = [];
+			fun early() {
+				try { return "try"; } finally { log.push("finally"); }
+			}
+			print early();
+			print log;
+
+			for (i in range(0, 3)) {
+				try {
+					if (i == 1) continue;
+					if (i == 2) break;
+				} finally {
+					log.push(i);
+				}
+			}
+			print log;
+
+			fun override() {
+				try { return 1; } finally { throw "finally"; }
+			}
+			var caught;
+			try { override(); } catch (e) { caught = e; }
+			print caught;
+
+			try {
+				try { throw "inner"; } finally { log.push("cleanup"); }
+			} catch (e) {
+				caught = e;
+			}
+			print "${caught} ${log.pop()}";
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"try", `["finally"]`, `["finally", 0, 1, 2]`, "finally", "inner cleanup"}, out)
+	})
+
+	t.Run("Returns from nested loops and blocks", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			var x = "global";
+			fun find(xs, target) {
+				var x = "local";
+				while (true) {
+					for (i, v in xs) {
+						{ if (v == target) return i; }
+					}
+					return -1;
+				}
+			}
+			print find([5, 6, 7], 7);
+			print find([], 7);
+			print x;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"2", "-1", "global"}, out)
+	})
+
+	t.Run("Traces runtime errors through calls", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := strings.Join([]string{
+			"class A {",
+			"  boom() { return -\"x\"; }",
+			"}",
+			"fun outer() {",
+			"  return A().boom();",
+			"}",
+			"outer();",
+		}, "\n")
+		stmts, err := ast.NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(err)
+		interpreter := eval.NewInterpreter(eval.WithFileName("test.lox"))
+		err = resolve.NewResolver(interpreter).Resolve(stmts)
+		assert.NoError(err)
+
+		err = interpreter.Interpret(stmts)
+		var errRuntime eval.ErrRuntime
+		assert.ErrorAs(err, &errRuntime)
+		assert.ErrorAs(err, &eval.ErrInterpret{})
+		assert.Equal([]string{
+			"at A.boom (test.lox:2)",
+			"at outer (test.lox:5)",
+			"at <script> (test.lox:7)",
+		}, errRuntime.Trace())
+		assert.Len(errRuntime.Frames(), 2)
+	})
+
+	t.Run("Gives caught errors a stack", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			fun inner() { return nil.field; }
+			fun outer() { return inner(); }
+			var caught;
+			try { outer(); } catch (e) { caught = e; }
+			print caught.stack;
+
+			fun thrower() { throw Error("bad"); }
+			try { thrower(); } catch (e) { caught = e; }
+			print caught.stack;
+
+			try { throw Error("top"); } catch (e) { caught = e; }
+			print caught.stack;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{
+			`["at inner (line 2)", "at outer (line 3)", "at <script> (line 5)"]`,
+			`["at thrower (line 8)", "at <script> (line 9)"]`,
+			`["at <script> (line 12)"]`,
+		}, out)
+	})
+
+	t.Run("Errors on stack overflow", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "fun down(n) { if (n == 0) return 0; return down(n - 1); }\ndown(20);"
+		stmts, err := ast.NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(err)
+
+		interpreter := eval.NewInterpreter(eval.WithMaxCallDepth(10))
+		err = resolve.NewResolver(interpreter).Resolve(stmts)
+		assert.NoError(err)
+		err = interpreter.Interpret(stmts)
+		var errInterpret eval.ErrInterpret
+		assert.ErrorAs(err, &errInterpret)
+		assert.Equal("Stack overflow calling 'down'.", errInterpret.Message())
+
+		var errRuntime eval.ErrRuntime
+		assert.ErrorAs(err, &errRuntime)
+		assert.Len(errRuntime.Frames(), 10)
+
+		interpreter = eval.NewInterpreter(eval.WithMaxCallDepth(0))
+		err = resolve.NewResolver(interpreter).Resolve(stmts)
+		assert.NoError(err)
+		assert.NoError(interpreter.Interpret(stmts))
+	})
+
+	t.Run("Catches stack overflow of runaway recursion", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			fun forever(n) { return forever(n + 1); }
+			var caught;
+			try { forever(0); } catch (e) { caught = e; }
+			print caught.message;
+			print caught.stack.len();
+			print caught.stack[15];
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"Stack overflow calling 'forever'.", "31", "... 995 more frames"}, out)
+	})
+
+	t.Run("Catches stack overflow of recursion through builtins", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			fun f(x) { return [x].map(f); }
+			try { f(1); } catch (e) { print e.message; print e.stack[0]; }
+
+			class A {
+				iterator() { for (x in this) {} return this; }
+				next() { return nil; }
+			}
+			try { for (x in A()) {} } catch (e) { print e.message; print e.stack[0]; }
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{
+			"Stack overflow calling 'f'.", "at map (line 2)",
+			"Stack overflow calling 'A.iterator'.", "at A.iterator (line 6)",
+		}, out)
+	})
+
+	t.Run("Errors uncaught throw at the throw", func(t *testing.T) {
+		assert := assert.New(t)
+
+		err := interpret("\nthrow \"oops\";")
+		var errThrow eval.ErrThrow
+		assert.ErrorAs(err, &errThrow)
+		assert.Equal("oops", errThrow.Value())
+		assert.Equal("Uncaught oops", errThrow.Message())
+		assert.Equal(2, errThrow.Span().Start.Line)
+	})
+
+	t.Run("Prints to stdout and reads input from stdin", func(t *testing.T) {
+		assert := assert.New(t)
+
+		stmts, err := ast.NewSourceParser(lex.NewScanner(`
+			var name = input("name?");
+			var greeting = input("greeting?");
+			print "${greeting}, ${name}";
+			print [1, "a"];
+		`)).Parse()
+		assert.NoError(err)
+
+		var out strings.Builder
+		interpreter, err := newInterpreter(stmts,
+			eval.WithStdout(&out),
+			eval.WithStdin(strings.NewReader("lox\nhello\n")))
+		assert.NoError(err)
+		assert.NoError(interpreter.Interpret(stmts))
+		assert.Equal("name?\ngreeting?\nhello, lox\n[1, \"a\"]\n", out.String())
+
+		// Input fails once stdin runs out
+		out.Reset()
+		interpreter, err = newInterpreter(stmts,
+			eval.WithStdout(&out),
+			eval.WithStdin(strings.NewReader("lox")))
+		assert.NoError(err)
+		assert.ErrorIs(interpreter.Interpret(stmts), io.EOF)
+		assert.Equal("name?\ngreeting?\n", out.String())
+	})
+
+	t.Run("Shares a buffered stdin between interpreters", func(t *testing.T) {
+		assert := assert.New(t)
+
+		stmts, err := ast.NewSourceParser(lex.NewScanner(`print input("word?");`)).Parse()
+		assert.NoError(err)
+
+		// Hides that strings.Reader can unread runes
+		in := bufio.NewReader(struct{ io.Reader }{strings.NewReader("one two")})
+		var out strings.Builder
+		for range 2 {
+			interpreter, err := newInterpreter(stmts, eval.WithStdout(&out), eval.WithStdin(in))
+			assert.NoError(err)
+			assert.NoError(interpreter.Interpret(stmts))
+		}
+		assert.Equal("word?\none\nword?\ntwo\n", out.String())
+	})
+}
+
+func TestInterpretBudget(t *testing.T) {
+	parse := func(t *testing.T, source string) []d.Stmt {
+		stmts, err := ast.NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(t, err)
+		return stmts
+	}
+
+	t.Run("Stops at the step limit", func(t *testing.T) {
+		assert := assert.New(t)
+
+		stmts := parse(t, "var n = 0;\nwhile (true) {\n  n = n + 1;\n}")
+		interpreter, err := newInterpreter(stmts, eval.WithMaxSteps(100))
+		assert.NoError(err)
+
+		err = interpreter.Interpret(stmts)
+		var errStep eval.ErrStepLimit
+		assert.ErrorAs(err, &errStep)
+		assert.Equal(int64(100), errStep.Limit)
+		assert.Equal("step limit of 100 exceeded", errStep.Message())
+		assert.Equal(2, errStep.Span().Start.Line)
+
+		// Every run gets a fresh budget
+		stmts = parse(t, "var n = 0;")
+		assert.NoError(interpreter.Interpret(stmts))
+	})
+
+	t.Run("Stops at the allocation limit", func(t *testing.T) {
+		assert := assert.New(t)
+
+		stmts := parse(t, "var xs = [];\nwhile (true) xs.push([1, 2]);")
+		interpreter, err := newInterpreter(stmts, eval.WithMaxAllocations(1000))
+		assert.NoError(err)
+
+		err = interpreter.Interpret(stmts)
+		var errAlloc eval.ErrAllocLimit
+		assert.ErrorAs(err, &errAlloc)
+		assert.Equal(int64(1000), errAlloc.Limit)
+		assert.Equal(2, errAlloc.Span().Start.Line)
+
+		stmts = parse(t, `var s = "a"; for (var i = 0; i < 10; i = i + 1) s = s + s;`)
+		interpreter, err = newInterpreter(stmts, eval.WithMaxAllocations(5))
+		assert.NoError(err)
+		assert.ErrorAs(interpreter.Interpret(stmts), &errAlloc)
+
+		// Strings count by their length
+		stmts = parse(t, `var s = "ab".repeat(10);`)
+		interpreter, err = newInterpreter(stmts, eval.WithMaxAllocations(20))
+		assert.NoError(err)
+		assert.ErrorAs(interpreter.Interpret(stmts), &errAlloc)
+		stmts = parse(t, `var s = "ab" + "cd";`)
+		interpreter, err = newInterpreter(stmts, eval.WithMaxAllocations(4))
+		assert.NoError(err)
+		assert.ErrorAs(interpreter.Interpret(stmts), &errAlloc)
+		stmts = parse(t, `var s = "ab" + "c";`)
+		interpreter, err = newInterpreter(stmts, eval.WithMaxAllocations(4))
+		assert.NoError(err)
+		assert.NoError(interpreter.Interpret(stmts))
+	})
+
+	t.Run("Stops at the timeout", func(t *testing.T) {
+		assert := assert.New(t)
+
+		stmts := parse(t, "while (true) {}")
+		interpreter, err := newInterpreter(stmts, eval.WithTimeout(10*time.Millisecond))
+		assert.NoError(err)
+
+		err = interpreter.Interpret(stmts)
+		var errTimeout eval.ErrTimeout
+		assert.ErrorAs(err, &errTimeout)
+		assert.Equal(10*time.Millisecond, errTimeout.Limit)
+
+		// A single statement calling back from natives is stopped as well
+		stmts = parse(t, `
+			var xs = [];
+			for (x in range(1000)) xs.push(x);
+			xs.map((a) => xs.map((b) => xs.map((c) => a + b + c)));
+		`)
+		interpreter, err = newInterpreter(stmts, eval.WithTimeout(10*time.Millisecond))
+		assert.NoError(err)
+
+		err = interpreter.Interpret(stmts)
+		assert.ErrorAs(err, &errTimeout)
+		assert.Equal(4, errTimeout.Span().Start.Line)
+	})
+
+	t.Run("Stops when the context is done", func(t *testing.T) {
+		assert := assert.New(t)
+
+		stmts := parse(t, "fun spin() { while (true) {} }\nspin();")
+		interpreter, err := newInterpreter(stmts)
+		assert.NoError(err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		err = interpreter.InterpretContext(ctx, stmts)
+		var errCanceled eval.ErrCanceled
+		assert.ErrorAs(err, &errCanceled)
+		assert.ErrorIs(err, context.Canceled)
+		assert.Equal(1, errCanceled.Span().Start.Line)
+
+		var errRuntime eval.ErrRuntime
+		assert.ErrorAs(err, &errRuntime)
+		assert.Equal([]string{"at spin (line 1)", "at <script> (line 2)"}, errRuntime.Trace())
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		err = interpreter.InterpretContext(ctx, stmts)
+		assert.ErrorIs(err, context.DeadlineExceeded)
+	})
+
+	t.Run("Does not catch budget errors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		stmts := parse(t, `
+			var finished = false;
+			try {
+				while (true) {}
+			} catch (e) {
+				finished = true;
+			} finally {
+				finished = true;
+			}
+			finished = true;
+		`)
+		interpreter, err := newInterpreter(stmts, eval.WithMaxSteps(50))
+		assert.NoError(err)
+
+		err = interpreter.Interpret(stmts)
+		assert.ErrorAs(err, &eval.ErrStepLimit{})
+	})
+}
+
+func TestEmbed(t *testing.T) {
+	t.Run("Calls natives defined by the host", func(t *testing.T) {
+		assert := assert.New(t)
+
+		interpreter := eval.NewInterpreter()
+		interpreter.DefineNative("double", 1, func(args []eval.Value) (eval.Value, error) {
+			n, ok := args[0].(float64)
+			if !ok {
+				return nil, fmt.Errorf("double takes a number")
+			}
+			return n * 2, nil
+		})
+
+		err := run(interpreter, `
+			var doubled = double(21);
+			var message;
+			try { double("a"); } catch (e) { message = e.message; }
+		`)
+		assert.NoError(err)
+
+		doubled, ok := interpreter.GetGlobal("doubled")
+		assert.True(ok)
+		assert.Equal(float64(42), doubled)
+		message, _ := interpreter.GetGlobal("message")
+		assert.Equal("double takes a number", message)
+
+		err = run(interpreter, "double(1, 2);")
+		assert.ErrorAs(err, &eval.ErrInterpret{})
+	})
+
+	t.Run("Calls variadic natives defined by the host", func(t *testing.T) {
+		assert := assert.New(t)
+
+		interpreter := eval.NewInterpreter()
+		interpreter.DefineNativeArity("join", eval.Arity{Min: 1, Max: eval.Variadic}, func(args []eval.Value) (eval.Value, error) {
+			parts := make([]string, len(args)-1)
+			for j, arg := range args[1:] {
+				parts[j] = fmt.Sprint(arg)
+			}
+			return strings.Join(parts, args[0].(string)), nil
+		})
+
+		err := run(interpreter, `var joined = join("-", "a", "b", "c"); var empty = join(",");`)
+		assert.NoError(err)
+		joined, _ := interpreter.GetGlobal("joined")
+		assert.Equal("a-b-c", joined)
+		empty, _ := interpreter.GetGlobal("empty")
+		assert.Equal("", empty)
+
+		var errInterpret eval.ErrInterpret
+		err = run(interpreter, "join();")
+		assert.ErrorAs(err, &errInterpret)
+		assert.Equal("expected at least 1 args but got 0 instead.", errInterpret.Message())
+	})
+
+	t.Run("Raises host errors at the call", func(t *testing.T) {
+		assert := assert.New(t)
+
+		errDenied := fmt.Errorf("access denied")
+		interpreter := eval.NewInterpreter()
+		interpreter.DefineNative("fetch", 0, func(args []eval.Value) (eval.Value, error) {
+			return nil, errDenied
+		})
+
+		err := run(interpreter, "\nfetch();")
+		assert.ErrorIs(err, errDenied)
+		var errInterpret eval.ErrInterpret
+		assert.ErrorAs(err, &errInterpret)
+		assert.Equal("access denied", errInterpret.Message())
+		assert.Equal(2, errInterpret.Span().Start.Line)
+	})
+
+	t.Run("Sets and gets globals", func(t *testing.T) {
+		assert := assert.New(t)
+
+		interpreter := eval.NewInterpreter()
+		interpreter.SetGlobal("limit", float64(3))
+		interpreter.SetGlobal("names", eval.NewList([]interface{}{"a", "b"}))
+
+		err := run(interpreter, `var summary = "${names} ${limit}"; limit = limit + 1;`)
+		assert.NoError(err)
+
+		summary, ok := interpreter.GetGlobal("summary")
+		assert.True(ok)
+		assert.Equal(`["a", "b"] 3`, summary)
+		limit, _ := interpreter.GetGlobal("limit")
+		assert.Equal(float64(4), limit)
+
+		_, ok = interpreter.GetGlobal("missing")
+		assert.False(ok)
+	})
+
+	t.Run("Converts Go values passed in by the host", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var out strings.Builder
+		interpreter := eval.NewInterpreter(eval.WithStdout(&out))
+		assert.NoError(interpreter.SetGlobal("n", 3))
+		assert.NoError(interpreter.SetGlobal("words", []string{"a", "b"}))
+		assert.EqualError(interpreter.SetGlobal("f", func() {}), "can't set 'f': can't convert Go func() to a Lox value")
+		interpreter.DefineNative("count", 1, func(args []eval.Value) (eval.Value, error) {
+			return len(args[0].(*eval.List).Elements()), nil
+		})
+
+		err := run(interpreter, `
+			print n + 1;
+			print count(words) + 1;
+			fun add(a, b) { return a + b; }
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"4", "3"}, lines(&out))
+
+		add, _ := interpreter.GetGlobal("add")
+		v, err := interpreter.Call(add, 1, int8(2))
+		assert.NoError(err)
+		assert.Equal(float64(3), v)
+		_, err = interpreter.Call(add, 1, make(chan int))
+		assert.EqualError(err, "argument 2: can't convert Go chan int to a Lox value")
+	})
+
+	t.Run("Calls Lox functions from the host", func(t *testing.T) {
+		assert := assert.New(t)
+
+		interpreter := eval.NewInterpreter()
+		err := run(interpreter, `
+			fun add(a, b) { return a + b; }
+			class Point {
+				init(x) { this.x = x; }
+			}
+			fun fail() { throw "nope"; }
+		`)
+		assert.NoError(err)
+
+		add, _ := interpreter.GetGlobal("add")
+		v, err := interpreter.Call(add, float64(1), float64(2))
+		assert.NoError(err)
+		assert.Equal(float64(3), v)
+
+		_, err = interpreter.Call(add, float64(1))
+		assert.EqualError(err, "expected a function taking 1 args but it takes 2")
+		_, err = interpreter.Call("add")
+		assert.EqualError(err, "expected a function but got 'add'")
+
+		point, _ := interpreter.GetGlobal("Point")
+		v, err = interpreter.Call(point, float64(7))
+		assert.NoError(err)
+		assert.IsType(&eval.Instance{}, v)
+
+		fail, _ := interpreter.GetGlobal("fail")
+		_, err = interpreter.Call(fail)
+		var errThrow eval.ErrThrow
+		assert.ErrorAs(err, &errThrow)
+		assert.Equal("nope", errThrow.Value())
+	})
+
+	t.Run("Calls back into Lox from natives", func(t *testing.T) {
+		assert := assert.New(t)
+
+		interpreter := eval.NewInterpreter(eval.WithMaxSteps(1000))
+		interpreter.DefineNative("twice", 1, func(args []eval.Value) (eval.Value, error) {
+			for range 2 {
+				_, err := interpreter.Call(args[0])
+				if err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		})
+
+		err := run(interpreter, `
+			var n = 0;
+			twice(fun () { n = n + 1; });
+		`)
+		assert.NoError(err)
+		n, _ := interpreter.GetGlobal("n")
+		assert.Equal(float64(2), n)
+
+		// The nested calls count against the script's budget
+		err = run(interpreter, "twice(fun () { while (true) {} });")
+		assert.ErrorAs(err, &eval.ErrStepLimit{})
+	})
+}
+
+type address struct {
+	City string
+}
+
+type account struct {
+	Owner   string
+	Balance float64
+	Tags    []string
+	Limits  map[string]int
+	Home    address
+	Parent  *account
+
+	id int
+}
+
+func (a *account) Deposit(amount float64) {
+	a.Balance += amount
+}
+
+func (a *account) Withdraw(amount uint) (float64, error) {
+	if float64(amount) > a.Balance {
+		return 0, errInsufficient
+	}
+	a.Balance -= float64(amount)
+	return a.Balance, nil
+}
+
+func (a *account) AddTags(tags ...string) int {
+	a.Tags = append(a.Tags, tags...)
+	return len(a.Tags)
+}
+
+func (a account) Summary(prefix string) string {
+	return fmt.Sprintf("%s%s: %g", prefix, a.Owner, a.Balance)
+}
+
+func (a *account) Describe(v interface{}) string {
+	return fmt.Sprint(v)
+}
+
+func (a *account) ParentOwner() string {
+	return a.Parent.Owner
+}
+
+var errInsufficient = fmt.Errorf("insufficient funds")
+
+func TestBind(t *testing.T) {
+	t.Run("Binds struct fields and methods", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var out strings.Builder
+		interpreter := eval.NewInterpreter(eval.WithStdout(&out))
+		assert.NoError(interpreter.DefineStruct("Account", account{}))
+
+		err := run(interpreter, `
+			var acct = Account();
+			print acct;
+			acct.Owner = "ada";
+			acct.Tags = ["a", "b"];
+			acct.Limits = {"daily": 100};
+			acct.Home.City = "London";
+			acct.Deposit(50);
+			print acct.Withdraw(20);
+			print acct.Summary("> ");
+			print acct.Tags;
+			print acct.Limits["daily"];
+			print acct.Parent;
+			print acct == acct;
+			print "${acct.AddTags()} ${acct.AddTags("c", "d")}";
+
+			try { acct.Withdraw(100); } catch (e) { print e.message; }
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{
+			"Account instance",
+			"30", "> ada: 30",
+			`["a", "b"]`, "100",
+			"nil", "true",
+			"2 4",
+			"insufficient funds",
+		}, lines(&out))
+
+		v, ok := interpreter.GetGlobal("acct")
+		assert.True(ok)
+		acct := v.(*eval.GoObject).Interface().(*account)
+		assert.Equal(&account{
+			Owner:   "ada",
+			Balance: 30,
+			Tags:    []string{"a", "b", "c", "d"},
+			Limits:  map[string]int{"daily": 100},
+			Home:    address{City: "London"},
+		}, acct)
+	})
+
+	t.Run("Errors on values that don't convert", func(t *testing.T) {
+		assert := assert.New(t)
+
+		interpreter := eval.NewInterpreter()
+		assert.NoError(interpreter.DefineStruct("Account", &account{}))
+
+		var errInterpret eval.ErrInterpret
+		err := run(interpreter, "var acct = Account();\nacct.Balance = \"lots\";")
+		assert.ErrorAs(err, &errInterpret)
+		assert.Equal("can't convert 'lots' to Go float64", errInterpret.Message())
+		assert.Equal(2, errInterpret.Span().Start.Line)
+
+		err = run(interpreter, "Account().Withdraw(1.5);")
+		assert.ErrorAs(err, &errInterpret)
+		assert.Equal("argument 1 of 'Withdraw': 1.5 doesn't fit in uint", errInterpret.Message())
+
+		err = run(interpreter, "Account().Withdraw(-1);")
+		assert.ErrorAs(err, &errInterpret)
+
+		err = run(interpreter, "Account().Withdraw(5);")
+		assert.ErrorIs(err, errInsufficient)
+
+		err = run(interpreter, "var xs = [1];\nxs.push(xs);\nAccount().Describe(xs);")
+		assert.ErrorAs(err, &errInterpret)
+		assert.Equal("argument 1 of 'Describe': can't convert a list containing itself to Go", errInterpret.Message())
+		assert.Equal(3, errInterpret.Span().Start.Line)
+		err = run(interpreter, `var m = {}; m["m"] = [m]; Account().Describe(m);`)
+		assert.ErrorAs(err, &errInterpret)
+		assert.Equal("argument 1 of 'Describe': can't convert a map containing itself to Go", errInterpret.Message())
+		err = run(interpreter, "var a = [1];\nvar shared = Account().Describe([a, a]);")
+		assert.NoError(err)
+		shared, _ := interpreter.GetGlobal("shared")
+		assert.Equal("[[1] [1]]", shared)
+
+		err = run(interpreter, `
+			var caught;
+			try { Account().ParentOwner(); } catch (e) { caught = e.message; }
+		`)
+		assert.NoError(err)
+		caught, _ := interpreter.GetGlobal("caught")
+		assert.Equal("'ParentOwner' panicked: runtime error: invalid memory address or nil pointer dereference", caught)
+
+		var errClass eval.ErrClass
+		err = run(interpreter, "Account().id;")
+		assert.ErrorAs(err, &errClass)
+		assert.Equal("Undefined property 'id'", errClass.Message())
+
+		assert.Error(interpreter.DefineStruct("Number", 1))
+	})
+
+	t.Run("Compares Go objects by what they point to", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var out strings.Builder
+		interpreter := eval.NewInterpreter(eval.WithStdout(&out))
+		parent := &account{Owner: "bank"}
+		acct := &account{Owner: "ada", Parent: parent}
+		assert.NoError(interpreter.SetGlobal("acct", acct))
+		assert.NoError(interpreter.SetGlobal("same", acct))
+		assert.NoError(interpreter.SetGlobal("parent", parent))
+		assert.NoError(interpreter.SetGlobal("other", &account{Owner: "bank"}))
+
+		err := run(interpreter, `
+			print acct == same;
+			print acct.Parent == parent;
+			print parent == acct.Parent;
+			print acct.Parent == other;
+			print acct == acct.Parent;
+			print acct.Home == acct.Home;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"true", "true", "true", "false", "false", "true"}, lines(&out))
+	})
+
+	t.Run("Converts Go values for scripts", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var out strings.Builder
+		interpreter := eval.NewInterpreter(eval.WithStdout(&out))
+		parent := &account{Owner: "bank"}
+		acct := &account{Owner: "ada", Balance: 10, Parent: parent}
+		for name, v := range map[string]interface{}{
+			"acct":   acct,
+			"nums":   []int{1, 2, 3},
+			"ages":   map[string]uint8{"ada": 36},
+			"nested": []interface{}{nil, true, "x", [2]float32{0.5, 1}},
+		} {
+			converted, err := interpreter.ToValue(v)
+			assert.NoError(err)
+			interpreter.SetGlobal(name, converted)
+		}
+
+		err := run(interpreter, `
+			print nums;
+			print ages["ada"];
+			print nested;
+			print acct.Parent;
+			acct.Parent.Owner = "central bank";
+			print acct.Parent == acct.Parent;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"[1, 2, 3]", "36", `[nil, true, "x", [0.5, 1]]`, "account instance", "true"}, lines(&out))
+		assert.Equal("central bank", parent.Owner)
+
+		_, err = interpreter.ToValue(func() {})
+		assert.EqualError(err, "can't convert Go func() to a Lox value")
+	})
+}
+
+func TestMath(t *testing.T) {
+	// callMath calls math.name with args, passed in as globals
+	callMath := func(name string, args ...float64) (eval.Value, error) {
+		params := make([]string, len(args))
+		for j := range args {
+			params[j] = fmt.Sprintf("a%d", j)
+		}
+		source := fmt.Sprintf("var result = math.%s(%s);", name, strings.Join(params, ", "))
+		stmts, err := ast.NewSourceParser(lex.NewScanner(source)).Parse()
+		if err != nil {
+			return nil, err
+		}
+		interpreter, err := newInterpreter(stmts)
+		if err != nil {
+			return nil, err
+		}
+		for j, arg := range args {
+			interpreter.SetGlobal(params[j], arg)
+		}
+		err = interpreter.Interpret(stmts)
+		if err != nil {
+			return nil, err
+		}
+		result, _ := interpreter.GetGlobal("result")
+		return result, nil
+	}
+
+	inputs := []float64{0, 0.5, -0.5, 1, -1.5, 2.5, 3, 10, 1e-9, math.Inf(1), math.Inf(-1), math.NaN()}
+
+	t.Run("Matches Go's math functions", func(t *testing.T) {
+		assert := assert.New(t)
+
+		unary := map[string]func(float64) float64{
+			"floor": math.Floor,
+			"ceil":  math.Ceil,
+			"round": math.Round,
+			"trunc": math.Trunc,
+			"abs":   math.Abs,
+			"sqrt":  math.Sqrt,
+			"exp":   math.Exp,
+			"log":   math.Log,
+			"log2":  math.Log2,
+			"log10": math.Log10,
+			"sin":   math.Sin,
+			"cos":   math.Cos,
+			"tan":   math.Tan,
+			"asin":  math.Asin,
+			"acos":  math.Acos,
+			"atan":  math.Atan,
+		}
+		for name, fn := range unary {
+			for _, x := range inputs {
+				v, err := callMath(name, x)
+				assert.NoError(err)
+				assertSameFloat(t, fn(x), v, "math.%s(%v)", name, x)
+			}
+		}
+
+		binary := map[string]func(float64, float64) float64{
+			"pow":   math.Pow,
+			"atan2": math.Atan2,
+			"min":   math.Min,
+			"max":   math.Max,
+		}
+		for name, fn := range binary {
+			for _, x := range inputs {
+				for _, y := range inputs {
+					v, err := callMath(name, x, y)
+					assert.NoError(err)
+					assertSameFloat(t, fn(x, y), v, "math.%s(%v, %v)", name, x, y)
+				}
+			}
+		}
+
+		for _, x := range inputs {
+			v, err := callMath("isNaN", x)
+			assert.NoError(err)
+			assert.Equal(math.IsNaN(x), v)
+			v, err = callMath("isInf", x)
+			assert.NoError(err)
+			assert.Equal(math.IsInf(x, 0), v)
+		}
+	})
+
+	t.Run("Folds min and max over any number of args", func(t *testing.T) {
+		assert := assert.New(t)
+
+		v, err := callMath("min", 3, 1, 2)
+		assert.NoError(err)
+		assert.Equal(float64(1), v)
+		v, err = callMath("max", 3, 1, 2, math.Inf(-1))
+		assert.NoError(err)
+		assert.Equal(float64(3), v)
+		v, err = callMath("max", 7)
+		assert.NoError(err)
+		assert.Equal(float64(7), v)
+
+		var errInterpret eval.ErrInterpret
+		_, err = callMath("min")
+		assert.ErrorAs(err, &errInterpret)
+		assert.Equal("expected at least 1 args but got 0 instead.", errInterpret.Message())
+	})
+
+	t.Run("Has constants", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			print math.inf;
+			print -math.inf;
+			print math.nan;
+			print math.nan == math.nan;
+			print math;
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{"+Inf", "-Inf", "NaN", "false", "<module math>"}, out)
+
+		interpreter := eval.NewInterpreter()
+		assert.NoError(run(interpreter, "var pi = math.pi; var e = math.e;"))
+		pi, _ := interpreter.GetGlobal("pi")
+		assert.Equal(math.Pi, pi)
+		e, _ := interpreter.GetGlobal("e")
+		assert.Equal(math.E, e)
+	})
+
+	t.Run("Repeats random numbers for a seed", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := `
+			math.seed(42);
+			var xs = [math.random(), math.random(), math.random()];
+		`
+		stmts, err := ast.NewSourceParser(lex.NewScanner(source)).Parse()
+		assert.NoError(err)
+
+		rng := rand.New(rand.NewSource(42))
+		expected := eval.NewList([]interface{}{rng.Float64(), rng.Float64(), rng.Float64()})
+		for range 2 {
+			interpreter, err := newInterpreter(stmts)
+			assert.NoError(err)
+			assert.NoError(interpreter.Interpret(stmts))
+			xs, _ := interpreter.GetGlobal("xs")
+			assert.Equal(expected, xs)
+		}
+
+		interpreter := eval.NewInterpreter()
+		assert.NoError(run(interpreter, "var xs = []; for (i in range(100)) xs.push(math.random());"))
+		xs, _ := interpreter.GetGlobal("xs")
+		for _, x := range xs.(*eval.List).Elements() {
+			assert.True(x.(float64) >= 0 && x.(float64) < 1, x)
+		}
+	})
+
+	t.Run("Errors on bad args", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var errInterpret eval.ErrInterpret
+		err := interpret(`math.floor("1");`)
+		assert.ErrorAs(err, &errInterpret)
+		assert.Equal("math.floor takes numbers but got '1'", errInterpret.Message())
+
+		err = interpret(`math.max(1, nil);`)
+		assert.ErrorAs(err, &errInterpret)
+		assert.Equal("math.max takes numbers but got 'nil'", errInterpret.Message())
+
+		var errClass eval.ErrClass
+		err = interpret("math.tau;")
+		assert.ErrorAs(err, &errClass)
+		assert.Equal("Undefined property 'tau' in module math", errClass.Message())
+	})
+}
+
+func TestStrings(t *testing.T) {
+	t.Run("Calls string methods", func(t *testing.T) {
+		assert := assert.New(t)
+
+		out, err := output(`
+			print "héllo".len();
+			print "".len();
+			print "MiXed".upper();
+			print "MiXed".lower();
+			print "  pad\n".trim();
+			print "a,b,,c".split(",");
+			print ", ".join(["a", 1, nil]);
+			print "-".join([]).len();
+			print "${"hello".contains("ell")} ${"hello".contains("z")}";
+			print "${"hello".startsWith("he")} ${"hello".startsWith("lo")}";
+			print "héllo".indexOf("l");
+			print "hello".indexOf("z");
+			print "a-b-c".replace("-", "+");
+			print "héllo".substr(1, 3);
+			print "hello".substr(-3);
+			print "hello".substr(3, 1).len();
+			print "hello".substr(0, 99);
+			print "hé".chars();
+			print "ab".repeat(3);
+			print "ab".repeat(0).len();
+
+			var upper = "abc".upper;
+			print upper();
+			var words = [];
+			for (w in "one two".split(" ")) words.push(w.upper());
+			print " ".join(words);
+		`)
+		assert.NoError(err)
+		assert.Equal([]string{
+			"5", "0",
+			"MIXED", "mixed", "pad",
+			`["a", "b", "", "c"]`,
+			"a, 1, nil", "0",
+			"true false", "true false",
+			"2", "-1",
+			"a+b+c",
+			"él", "llo", "0", "hello",
+			`["h", "é"]`,
+			"ababab", "0",
+			"ABC", "ONE TWO",
+		}, out)
+	})
+
+	t.Run("Errors on bad string method args", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var errInterpret eval.ErrInterpret
+		for source, message := range map[string]string{
+			`"a".split(1);`:        "split takes a string but got '1'",
+			`"a".replace("a", 1);`: "replace takes a string but got '1'",
+			`",".join("ab");`:      "join takes a list but got 'ab'",
+			`"a".repeat(-1);`:      "repeat count must be a whole number of at least 0 but got '-1'",
+			`"a".repeat(1.5);`:     "repeat count must be a whole number of at least 0 but got '1.5'",
+			`"ab".repeat(1e10);`:   "repeated string would be longer than 1073741824 bytes",
+			`"".repeat(1e19);`:     "repeat count must be at most 2147483647 but got '1e+19'",
+			`"a".substr("b");`:     "index must be a whole number but got 'b'",
+			`"a".substr();`:        "expected 1 to 2 args but got 0 instead.",
+		} {
+			err := interpret(source)
+			assert.ErrorAs(err, &errInterpret, source)
+			assert.Equal(message, errInterpret.Message(), source)
+		}
+
+		var errClass eval.ErrClass
+		err := interpret(`"a".size;`)
+		assert.ErrorAs(err, &errClass)
+		assert.Equal("Undefined property 'size'", errClass.Message())
+	})
+
+	t.Run("Converts with str and num", func(t *testing.T) {
+		assert := assert.New(t)
+
+		interpreter := eval.NewInterpreter()
+		err := run(interpreter, `
+			class A {}
+			var strs = [
+				str(1), str(1.5), str(-0.25), str(nil), str(true), str("s"),
+				str([1, "a"]), str({"k": 1}), str(A()),
+			];
+			var nums = [
+				num("42"), num(" -1.5 "), num(7),
+				num("1_000"), num("0xff"), num("2e3"), num(str(0.1)),
+			];
+		`)
+		assert.NoError(err)
+		strs, _ := interpreter.GetGlobal("strs")
+		assert.Equal([]interface{}{
+			"1", "1.5", "-0.25", "nil", "true", "s",
+			`[1, "a"]`, `{"k": 1}`, "A instance",
+		}, strs.(*eval.List).Elements())
+		nums, _ := interpreter.GetGlobal("nums")
+		assert.Equal([]interface{}{
+			float64(42), -1.5, float64(7),
+			float64(1000), float64(255), float64(2000), 0.1,
+		}, nums.(*eval.List).Elements())
+
+		var errInterpret eval.ErrInterpret
+		for source, message := range map[string]string{
+			`num("abc");`: `can't convert "abc" to a number`,
+			`num("1e");`:  `can't convert "1e" to a number`,
+			`num("");`:    `can't convert "" to a number`,
+			`num(nil);`:   "can't convert 'nil' to a number",
+			`num(true);`:  "can't convert 'true' to a number",
+		} {
+			err := interpret(source)
+			assert.ErrorAs(err, &errInterpret, source)
+			assert.Equal(message, errInterpret.Message(), source)
+		}
+	})
+}
+
+// assertSameFloat compares floats exactly, treating NaN as equal to itself.
+func assertSameFloat(t *testing.T, expected float64, actual interface{}, msgAndArgs ...interface{}) {
+	t.Helper()
+	if math.IsNaN(expected) {
+		f, ok := actual.(float64)
+		assert.True(t, ok && math.IsNaN(f), msgAndArgs...)
+		return
+	}
+	assert.Equal(t, expected, actual, msgAndArgs...)
+}
+
+// BenchmarkFib measures deep recursion, where every call unwinds through a
+// return statement.
+func BenchmarkFib(b *testing.B) {
+	source := `
+		fun fib(n) {
+			if (n <= 1) return n;
+			return fib(n - 2) + fib(n - 1);
+		}
+		fib(20);
+	`
+	stmts, err := ast.NewSourceParser(lex.NewScanner(source)).Parse()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		interpreter, err := newInterpreter(stmts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = interpreter.Interpret(stmts)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,186 @@
+package eval
+
+import (
+	d "example/compilers/domain"
+	"example/compilers/util"
+	"fmt"
+)
+
+// Range is the lazy sequence of numbers returned by the range native.
+type Range struct {
+	start float64
+	end   float64
+	step  float64
+}
+
+func NewRange(start float64, end float64, step float64) *Range {
+	return &Range{
+		start: start,
+		end:   end,
+		step:  step,
+	}
+}
+
+func (r *Range) String() string {
+	if r.step != 1 {
+		return fmt.Sprintf("range(%s, %s, %s)", util.ToString(r.start), util.ToString(r.end), util.ToString(r.step))
+	}
+	return fmt.Sprintf("range(%s, %s)", util.ToString(r.start), util.ToString(r.end))
+}
+
+// done reports whether n is past the end, counting down for a negative step.
+func (r *Range) done(n float64) bool {
+	if r.step < 0 {
+		return n <= r.end
+	}
+	return n >= r.end
+}
+
+// rangeFn is range(end), range(start, end) or range(start, end, step),
+// counting from 0 and by 1 unless told otherwise.
+var rangeFn = newNativeFnArity("range", Arity{Min: 1, Max: 3}, func(in *Interpreter, args []interface{}) (interface{}, error) {
+	bounds := make([]float64, len(args))
+	for j, arg := range args {
+		n, ok := arg.(float64)
+		if !ok {
+			return nil, nativeErrorf("range %s must be a number but got '%s'", rangeArgs[len(args)-1][j], util.ToString(arg))
+		}
+		bounds[j] = n
+	}
+
+	r := NewRange(0, bounds[0], 1)
+	if len(bounds) > 1 {
+		r.start, r.end = bounds[0], bounds[1]
+	}
+	if len(bounds) > 2 {
+		r.step = bounds[2]
+	}
+	if r.step == 0 {
+		return nil, nativeErrorf("range step can't be 0")
+	}
+
+	if err := in.allocate(1); err != nil {
+		return nil, err
+	}
+	return r, nil
+})
+
+// rangeArgs names the args of range for each number of them.
+var rangeArgs = [][]string{
+	{"end"},
+	{"start", "end"},
+	{"start", "end", "step"},
+}
+
+// nextFn yields the loop variables for one step of a for-in loop, with ok
+// false once the iterable is done.
+type nextFn func() (values []interface{}, ok bool, err error)
+
+// iterator steps through the builtin iterables and through instances
+// following the iterator protocol. A single loop variable gets the element
+// of a list, string or range, or the key of a map. With two, lists, strings
+// and ranges also give the index first, and maps give the key and value.
+func (i *Interpreter) iterator(iterable interface{}, vars int, at *d.Token) (nextFn, error) {
+	pick := func(key interface{}, value interface{}) []interface{} {
+		if vars == 1 {
+			return []interface{}{value}
+		}
+		return []interface{}{key, value}
+	}
+
+	switch it := iterable.(type) {
+	case *List:
+		index := 0
+		return func() ([]interface{}, bool, error) {
+			if index >= len(it.elements) {
+				return nil, false, nil
+			}
+			index++
+			return pick(float64(index-1), it.elements[index-1]), true, nil
+		}, nil
+	case string:
+		chars := []rune(it)
+		index := 0
+		return func() ([]interface{}, bool, error) {
+			if index >= len(chars) {
+				return nil, false, nil
+			}
+			index++
+			return pick(float64(index-1), string(chars[index-1])), true, nil
+		}, nil
+	case *Map:
+		// Keys added while looping are left out, deleted ones are skipped
+		keys := make([]interface{}, len(it.keys))
+		copy(keys, it.keys)
+		index := 0
+		return func() ([]interface{}, bool, error) {
+			for index < len(keys) {
+				key := keys[index]
+				index++
+				if value, ok := it.values[key]; ok {
+					if vars == 1 {
+						return []interface{}{key}, true, nil
+					}
+					return []interface{}{key, value}, true, nil
+				}
+			}
+			return nil, false, nil
+		}, nil
+	case *Range:
+		index := 0
+		return func() ([]interface{}, bool, error) {
+			n := it.start + float64(index)*it.step
+			if it.done(n) {
+				return nil, false, nil
+			}
+			index++
+			return pick(float64(index-1), n), true, nil
+		}, nil
+	case *Instance:
+		return i.instanceIterator(it, vars, at)
+	}
+
+	return nil, nativeErrorf("can't iterate over '%s'", util.ToString(iterable))
+}
+
+// instanceIterator follows the iterator protocol: iterator() returns an
+// object whose next() gives each element in turn and nil when done. An
+// instance with next() but no iterator() is its own iterator. With two loop
+// variables each element must be a [key, value] list.
+func (i *Interpreter) instanceIterator(instance *Instance, vars int, at *d.Token) (nextFn, error) {
+	iter := instance
+	if method := instance.Clazz.FindMethod("iterator"); method != nil {
+		v, err := callbackAt(i, at, method.Bind(instance))
+		if err != nil {
+			return nil, err
+		}
+
+		it, ok := v.(*Instance)
+		if !ok {
+			return nil, nativeErrorf("iterator() must return an instance but got '%s'", util.ToString(v))
+		}
+		iter = it
+	}
+
+	method := iter.Clazz.FindMethod("next")
+	if method == nil {
+		return nil, nativeErrorf("'%s' has no iterator() or next() method", util.ToString(instance))
+	}
+	next := method.Bind(iter)
+
+	return func() ([]interface{}, bool, error) {
+		v, err := callbackAt(i, at, next)
+		if err != nil || v == nil {
+			return nil, false, err
+		}
+		if vars == 1 {
+			return []interface{}{v}, true, nil
+		}
+
+		pair, ok := v.(*List)
+		if !ok || pair.Len() != 2 {
+			return nil, false, nativeErrorf("next() must return a [key, value] list but got '%s'", util.ToString(v))
+		}
+		return pair.Elements(), true, nil
+	}, nil
+}
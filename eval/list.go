@@ -0,0 +1,264 @@
+package eval
+
+import (
+	d "example/compilers/domain"
+	"example/compilers/util"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// List is the runtime value of a list literal. It is shared by reference,
+// so a list passed to a function can be changed by it.
+type List struct {
+	elements []interface{}
+}
+
+func NewList(elements []interface{}) *List {
+	return &List{elements: elements}
+}
+
+func (l *List) Elements() []interface{} {
+	return l.elements
+}
+
+func (l *List) Len() int {
+	return len(l.elements)
+}
+
+func (l *List) String() string {
+	return l.format(make(map[interface{}]bool))
+}
+
+// format shows the list, with seen holding the collections being shown
+// further up. A list inside itself shows as [...].
+func (l *List) format(seen map[interface{}]bool) string {
+	if seen[l] {
+		return "[...]"
+	}
+	seen[l] = true
+	defer delete(seen, l)
+
+	parts := make([]string, len(l.elements))
+	for i, element := range l.elements {
+		parts[i] = reprIn(element, seen)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// repr shows strings quoted when printed inside a collection.
+func repr(v interface{}) string {
+	return reprIn(v, make(map[interface{}]bool))
+}
+
+// reprIn is repr for a value inside the collections in seen.
+func reprIn(v interface{}, seen map[interface{}]bool) string {
+	switch x := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", x)
+	case *List:
+		return x.format(seen)
+	case *Map:
+		return x.format(seen)
+	}
+	return util.ToString(v)
+}
+
+func (l *List) At(index interface{}) (interface{}, error) {
+	i, err := l.index(index)
+	if err != nil {
+		return nil, err
+	}
+	return l.elements[i], nil
+}
+
+func (l *List) SetAt(index interface{}, value interface{}) error {
+	i, err := l.index(index)
+	if err != nil {
+		return err
+	}
+	l.elements[i] = value
+	return nil
+}
+
+// Slice copies the elements in [start, end) into a new list.
+func (l *List) Slice(start interface{}, end interface{}) (*List, error) {
+	from, err := toBound(start, len(l.elements), 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := toBound(end, len(l.elements), len(l.elements))
+	if err != nil {
+		return nil, err
+	}
+
+	elements := make([]interface{}, 0, max(0, to-from))
+	if from < to {
+		elements = append(elements, l.elements[from:to]...)
+	}
+	return NewList(elements), nil
+}
+
+func (l *List) index(v interface{}) (int, error) {
+	i, err := toIndex(v, len(l.elements))
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 || i >= len(l.elements) {
+		return 0, nativeErrorf("index %s out of range for list of length %d", util.ToString(v), len(l.elements))
+	}
+	return i, nil
+}
+
+// Get looks up one of the builtin list methods.
+func (l *List) Get(name *d.Token) (interface{}, error) {
+	switch name.Lexeme {
+	case "len":
+		return newNativeFn("len", 0, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			return float64(len(l.elements)), nil
+		}), nil
+	case "push":
+		return newNativeFn("push", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			if err := in.allocate(1); err != nil {
+				return nil, err
+			}
+			l.elements = append(l.elements, args[0])
+			return nil, nil
+		}), nil
+	case "pop":
+		return newNativeFn("pop", 0, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			if len(l.elements) == 0 {
+				return nil, nativeErrorf("can't pop from an empty list")
+			}
+			last := l.elements[len(l.elements)-1]
+			l.elements = l.elements[:len(l.elements)-1]
+			return last, nil
+		}), nil
+	case "insert":
+		return newNativeFn("insert", 2, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			i, err := toIndex(args[0], len(l.elements))
+			if err != nil {
+				return nil, err
+			}
+			if i < 0 || i > len(l.elements) {
+				return nil, nativeErrorf("index %s out of range for list of length %d", util.ToString(args[0]), len(l.elements))
+			}
+			if err := in.allocate(1); err != nil {
+				return nil, err
+			}
+			l.elements = append(l.elements[:i], append([]interface{}{args[1]}, l.elements[i:]...)...)
+			return nil, nil
+		}), nil
+	case "remove":
+		return newNativeFn("remove", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			i, err := l.index(args[0])
+			if err != nil {
+				return nil, err
+			}
+			removed := l.elements[i]
+			l.elements = append(l.elements[:i], l.elements[i+1:]...)
+			return removed, nil
+		}), nil
+	case "map":
+		return newNativeFn("map", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			if err := in.allocate(1 + len(l.elements)); err != nil {
+				return nil, err
+			}
+			mapped := make([]interface{}, len(l.elements))
+			for i, element := range l.elements {
+				v, err := callback(in, args[0], element)
+				if err != nil {
+					return nil, err
+				}
+				mapped[i] = v
+			}
+			return NewList(mapped), nil
+		}), nil
+	case "filter":
+		return newNativeFn("filter", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			if err := in.allocate(1); err != nil {
+				return nil, err
+			}
+			filtered := make([]interface{}, 0)
+			for _, element := range l.elements {
+				keep, err := callback(in, args[0], element)
+				if err != nil {
+					return nil, err
+				}
+				if in.isTruthy(keep) {
+					if err := in.allocate(1); err != nil {
+						return nil, err
+					}
+					filtered = append(filtered, element)
+				}
+			}
+			return NewList(filtered), nil
+		}), nil
+	case "reduce":
+		return newNativeFn("reduce", 2, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			acc := args[1]
+			for _, element := range l.elements {
+				var err error
+				acc, err = callback(in, args[0], acc, element)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return acc, nil
+		}), nil
+	case "sort":
+		return newNativeFnArity("sort", Arity{Min: 0, Max: 1}, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			if len(args) == 0 {
+				return nil, l.sort(lessThan)
+			}
+			return nil, l.sort(func(a interface{}, b interface{}) (bool, error) {
+				less, err := callback(in, args[0], a, b)
+				return in.isTruthy(less), err
+			})
+		}), nil
+	}
+
+	return nil, newErrClass(name, fmt.Sprintf("Undefined property '%s'", name.Lexeme))
+}
+
+// sort orders the list by less: by default numbers or strings in their
+// natural order, or by a comparator returning whether a goes before b. The
+// list only changes once sorting succeeds, so an error leaves it as it was
+// and a comparator changing it can't upset the sort.
+func (l *List) sort(less func(a interface{}, b interface{}) (bool, error)) error {
+	sorted := make([]interface{}, len(l.elements))
+	copy(sorted, l.elements)
+
+	var err error
+	sort.SliceStable(sorted, func(a, b int) bool {
+		// Once an error is raised, leave the rest as it is
+		if err != nil {
+			return false
+		}
+		isLess, cmpErr := less(sorted[a], sorted[b])
+		if cmpErr != nil {
+			err = cmpErr
+		}
+		return isLess
+	})
+	if err != nil {
+		return err
+	}
+
+	l.elements = sorted
+	return nil
+}
+
+func lessThan(a interface{}, b interface{}) (bool, error) {
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			return x < y, nil
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return x < y, nil
+		}
+	}
+	return false, nativeErrorf("can't compare '%s' with '%s'", util.ToString(a), util.ToString(b))
+}
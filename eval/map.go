@@ -0,0 +1,165 @@
+package eval
+
+import (
+	d "example/compilers/domain"
+	"example/compilers/util"
+	"fmt"
+	"strings"
+)
+
+// Map is the runtime value of a map literal. Entries keep the order they
+// were first added in, so printing and iterating a map is stable.
+type Map struct {
+	keys   []interface{}
+	values map[interface{}]interface{}
+}
+
+func NewMap() *Map {
+	return &Map{
+		keys:   make([]interface{}, 0),
+		values: make(map[interface{}]interface{}),
+	}
+}
+
+// Keys returns the keys in insertion order.
+func (m *Map) Keys() []interface{} {
+	return m.keys
+}
+
+func (m *Map) Len() int {
+	return len(m.keys)
+}
+
+func (m *Map) String() string {
+	return m.format(make(map[interface{}]bool))
+}
+
+// format shows the map, guarding against cycles like List.format. A map
+// inside itself shows as {...}.
+func (m *Map) format(seen map[interface{}]bool) string {
+	if seen[m] {
+		return "{...}"
+	}
+	seen[m] = true
+	defer delete(seen, m)
+
+	parts := make([]string, len(m.keys))
+	for i, key := range m.keys {
+		parts[i] = reprIn(key, seen) + ": " + reprIn(m.values[key], seen)
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// checkKey allows the values that compare by value, plus instances, which
+// compare by identity.
+func checkKey(key interface{}) error {
+	switch key.(type) {
+	case nil, float64, string, bool, *Instance:
+		return nil
+	}
+	return nativeErrorf("'%s' can't be used as a map key", util.ToString(key))
+}
+
+func (m *Map) Has(key interface{}) (bool, error) {
+	err := checkKey(key)
+	if err != nil {
+		return false, err
+	}
+	_, ok := m.values[key]
+	return ok, nil
+}
+
+func (m *Map) At(key interface{}) (interface{}, error) {
+	err := checkKey(key)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := m.values[key]
+	if !ok {
+		return nil, nativeErrorf("key %s not found in map", repr(key))
+	}
+	return v, nil
+}
+
+func (m *Map) SetAt(key interface{}, value interface{}) error {
+	err := checkKey(key)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+	return nil
+}
+
+func (m *Map) Delete(key interface{}) (bool, error) {
+	err := checkKey(key)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := m.values[key]; !ok {
+		return false, nil
+	}
+
+	delete(m.values, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
+
+// Get looks up one of the builtin map methods.
+func (m *Map) Get(name *d.Token) (interface{}, error) {
+	switch name.Lexeme {
+	case "len":
+		return newNativeFn("len", 0, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			return float64(len(m.keys)), nil
+		}), nil
+	case "keys":
+		return newNativeFn("keys", 0, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			if err := in.allocate(1 + len(m.keys)); err != nil {
+				return nil, err
+			}
+			keys := make([]interface{}, len(m.keys))
+			copy(keys, m.keys)
+			return NewList(keys), nil
+		}), nil
+	case "values":
+		return newNativeFn("values", 0, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			if err := in.allocate(1 + len(m.keys)); err != nil {
+				return nil, err
+			}
+			values := make([]interface{}, len(m.keys))
+			for i, key := range m.keys {
+				values[i] = m.values[key]
+			}
+			return NewList(values), nil
+		}), nil
+	case "entries":
+		return newNativeFn("entries", 0, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			// Each entry is a list of two
+			if err := in.allocate(1 + 3*len(m.keys)); err != nil {
+				return nil, err
+			}
+			entries := make([]interface{}, len(m.keys))
+			for i, key := range m.keys {
+				entries[i] = NewList([]interface{}{key, m.values[key]})
+			}
+			return NewList(entries), nil
+		}), nil
+	case "has":
+		return newNativeFn("has", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			return m.Has(args[0])
+		}), nil
+	case "delete":
+		return newNativeFn("delete", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			return m.Delete(args[0])
+		}), nil
+	}
+
+	return nil, newErrClass(name, fmt.Sprintf("Undefined property '%s'", name.Lexeme))
+}
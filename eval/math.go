@@ -0,0 +1,120 @@
+package eval
+
+import (
+	"example/compilers/util"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// newMathModule builds the math global. Each interpreter gets its own
+// random source, seeded from the clock until a script calls math.seed.
+func newMathModule() *Module {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	members := map[string]interface{}{
+		"pi":  math.Pi,
+		"e":   math.E,
+		"inf": math.Inf(1),
+		"nan": math.NaN(),
+
+		"pow":   mathFn2("pow", math.Pow),
+		"atan2": mathFn2("atan2", math.Atan2),
+		"min":   mathFold("min", math.Min),
+		"max":   mathFold("max", math.Max),
+
+		"isNaN": newNativeFn("math.isNaN", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			x, err := mathArg("isNaN", args[0])
+			return math.IsNaN(x), err
+		}),
+		"isInf": newNativeFn("math.isInf", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			x, err := mathArg("isInf", args[0])
+			return math.IsInf(x, 0), err
+		}),
+
+		"random": newNativeFn("math.random", 0, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			return rng.Float64(), nil
+		}),
+		"seed": newNativeFn("math.seed", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			seed, err := mathArg("seed", args[0])
+			if err != nil {
+				return nil, err
+			}
+			rng.Seed(int64(seed))
+			return nil, nil
+		}),
+	}
+
+	for name, fn := range map[string]func(float64) float64{
+		"floor": math.Floor,
+		"ceil":  math.Ceil,
+		"round": math.Round,
+		"trunc": math.Trunc,
+		"abs":   math.Abs,
+		"sqrt":  math.Sqrt,
+		"exp":   math.Exp,
+		"log":   math.Log,
+		"log2":  math.Log2,
+		"log10": math.Log10,
+		"sin":   math.Sin,
+		"cos":   math.Cos,
+		"tan":   math.Tan,
+		"asin":  math.Asin,
+		"acos":  math.Acos,
+		"atan":  math.Atan,
+	} {
+		members[name] = mathFn1(name, fn)
+	}
+
+	return newModule("math", members)
+}
+
+func mathArg(name string, arg interface{}) (float64, error) {
+	x, ok := arg.(float64)
+	if !ok {
+		return 0, nativeErrorf("math.%s takes numbers but got '%s'", name, util.ToString(arg))
+	}
+	return x, nil
+}
+
+func mathFn1(name string, fn func(float64) float64) *nativeFn {
+	return newNativeFn("math."+name, 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+		x, err := mathArg(name, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return fn(x), nil
+	})
+}
+
+func mathFn2(name string, fn func(float64, float64) float64) *nativeFn {
+	return newNativeFn("math."+name, 2, func(in *Interpreter, args []interface{}) (interface{}, error) {
+		x, err := mathArg(name, args[0])
+		if err != nil {
+			return nil, err
+		}
+		y, err := mathArg(name, args[1])
+		if err != nil {
+			return nil, err
+		}
+		return fn(x, y), nil
+	})
+}
+
+// mathFold applies fn across one or more numbers, as in math.min(3, 1, 2).
+func mathFold(name string, fn func(float64, float64) float64) *nativeFn {
+	return newNativeFnArity("math."+name, Arity{Min: 1, Max: Variadic}, func(in *Interpreter, args []interface{}) (interface{}, error) {
+		acc, err := mathArg(name, args[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, arg := range args[1:] {
+			x, err := mathArg(name, arg)
+			if err != nil {
+				return nil, err
+			}
+			acc = fn(acc, x)
+		}
+		return acc, nil
+	})
+}
@@ -0,0 +1,32 @@
+package eval
+
+import (
+	d "example/compilers/domain"
+	"fmt"
+)
+
+// Module is a namespace of builtins, such as math, whose members scripts
+// read like properties.
+type Module struct {
+	name    string
+	members map[string]interface{}
+}
+
+func newModule(name string, members map[string]interface{}) *Module {
+	return &Module{
+		name:    name,
+		members: members,
+	}
+}
+
+func (m *Module) String() string {
+	return fmt.Sprintf("<module %s>", m.name)
+}
+
+func (m *Module) Get(name *d.Token) (interface{}, error) {
+	if v, ok := m.members[name.Lexeme]; ok {
+		return v, nil
+	}
+
+	return nil, newErrClass(name, fmt.Sprintf("Undefined property '%s' in module %s", name.Lexeme, m.name))
+}
@@ -0,0 +1,125 @@
+package eval
+
+import (
+	"errors"
+	d "example/compilers/domain"
+	"example/compilers/util"
+	"fmt"
+)
+
+// errNative is returned by builtins, which have no token of their own. The
+// interpreter points it at the call site through locate.
+type errNative struct {
+	message string
+	// Set when a host native failed, so hosts can still match it
+	cause error
+}
+
+func (e errNative) Error() string {
+	return e.message
+}
+
+func nativeErrorf(format string, args ...interface{}) error {
+	return errNative{message: fmt.Sprintf(format, args...)}
+}
+
+// locate turns an error raised by a builtin into a runtime error at t,
+// leaving every other error untouched.
+func locate(t *d.Token, err error) error {
+	var nErr errNative
+	if errors.As(err, &nErr) {
+		errInterpret := newErrInterpret(t, nErr.message)
+		errInterpret.cause = nErr.cause
+		return errInterpret
+	}
+	return err
+}
+
+// nativeFn is a builtin function, such as a method on a List.
+type nativeFn struct {
+	name  string
+	arity Arity
+	fn    func(in *Interpreter, args []interface{}) (interface{}, error)
+}
+
+var _ Callable = (*nativeFn)(nil)
+
+func newNativeFn(name string, arity int, fn func(in *Interpreter, args []interface{}) (interface{}, error)) *nativeFn {
+	return newNativeFnArity(name, Exactly(arity), fn)
+}
+
+// newNativeFnArity makes a builtin taking optional or variadic args, which
+// fn finds by the length of args.
+func newNativeFnArity(name string, arity Arity, fn func(in *Interpreter, args []interface{}) (interface{}, error)) *nativeFn {
+	return &nativeFn{
+		name:  name,
+		arity: arity,
+		fn:    fn,
+	}
+}
+
+func (n *nativeFn) Arity() Arity {
+	return n.arity
+}
+
+func (n *nativeFn) Call(in *Interpreter, args []interface{}) (interface{}, error) {
+	return n.fn(in, args)
+}
+
+func (n *nativeFn) String() string {
+	return fmt.Sprintf("<native fn %s>", n.name)
+}
+
+// callback calls a Lox function handed to a builtin, such as the mapper
+// passed to List.map. It counts towards the call depth like any call, with
+// its frame placed at the call to the builtin.
+func callback(in *Interpreter, fn interface{}, args ...interface{}) (interface{}, error) {
+	var at *d.Token
+	if len(in.frames) > 0 {
+		at = in.frames[len(in.frames)-1].Call
+	}
+	return callbackAt(in, at, fn, args...)
+}
+
+// callbackAt is callback for a call made by the statement at at, such as a
+// for-in loop calling next().
+func callbackAt(in *Interpreter, at *d.Token, fn interface{}, args ...interface{}) (interface{}, error) {
+	cb, ok := fn.(Callable)
+	if !ok {
+		return nil, nativeErrorf("expected a function but got '%s'", util.ToString(fn))
+	}
+	if !cb.Arity().Accepts(len(args)) {
+		return nil, nativeErrorf("expected a function taking %d args but it takes %s", len(args), cb.Arity())
+	}
+
+	return in.call(cb, args, at)
+}
+
+// toIndex checks that v is a whole number and resolves negative indexes
+// from the end of a sequence of the given length.
+func toIndex(v interface{}, length int) (int, error) {
+	n, ok := v.(float64)
+	if !ok || n != float64(int(n)) {
+		return 0, nativeErrorf("index must be a whole number but got '%s'", util.ToString(v))
+	}
+
+	index := int(n)
+	if index < 0 {
+		index += length
+	}
+	return index, nil
+}
+
+// toBound resolves a slice bound like toIndex, clamping it to the sequence.
+// A missing bound falls back to def.
+func toBound(v interface{}, length int, def int) (int, error) {
+	if v == nil {
+		return def, nil
+	}
+
+	bound, err := toIndex(v, length)
+	if err != nil {
+		return 0, err
+	}
+	return max(0, min(bound, length)), nil
+}
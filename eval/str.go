@@ -0,0 +1,201 @@
+package eval
+
+import (
+	d "example/compilers/domain"
+	"example/compilers/lex"
+	"example/compilers/util"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// stringMethod looks up one of the builtin methods on the string s. Like
+// indexing, lengths and positions count runes.
+func stringMethod(s string, name *d.Token) (interface{}, error) {
+	switch name.Lexeme {
+	case "len":
+		return newNativeFn("len", 0, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			return float64(utf8.RuneCountInString(s)), nil
+		}), nil
+	case "upper":
+		return stringFn("upper", 0, func(args []string) string {
+			return strings.ToUpper(s)
+		}), nil
+	case "lower":
+		return stringFn("lower", 0, func(args []string) string {
+			return strings.ToLower(s)
+		}), nil
+	case "trim":
+		return stringFn("trim", 0, func(args []string) string {
+			return strings.TrimSpace(s)
+		}), nil
+	case "replace":
+		return stringFn("replace", 2, func(args []string) string {
+			return strings.ReplaceAll(s, args[0], args[1])
+		}), nil
+	case "contains":
+		return newNativeFn("contains", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			sub, err := stringArg("contains", args[0])
+			return strings.Contains(s, sub), err
+		}), nil
+	case "startsWith":
+		return newNativeFn("startsWith", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			prefix, err := stringArg("startsWith", args[0])
+			return strings.HasPrefix(s, prefix), err
+		}), nil
+	case "indexOf":
+		return newNativeFn("indexOf", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			sub, err := stringArg("indexOf", args[0])
+			if err != nil {
+				return nil, err
+			}
+			i := strings.Index(s, sub)
+			if i < 0 {
+				return float64(-1), nil
+			}
+			return float64(utf8.RuneCountInString(s[:i])), nil
+		}), nil
+	case "split":
+		return newNativeFn("split", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			sep, err := stringArg("split", args[0])
+			if err != nil {
+				return nil, err
+			}
+			return newStringList(in, strings.Split(s, sep))
+		}), nil
+	case "chars":
+		return newNativeFn("chars", 0, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			return newStringList(in, strings.Split(s, ""))
+		}), nil
+	case "join":
+		return newNativeFn("join", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			l, ok := args[0].(*List)
+			if !ok {
+				return nil, nativeErrorf("join takes a list but got '%s'", util.ToString(args[0]))
+			}
+			parts := make([]string, l.Len())
+			for i, element := range l.elements {
+				parts[i] = util.ToString(element)
+			}
+			joined := strings.Join(parts, s)
+			if err := in.allocate(1 + len(joined)); err != nil {
+				return nil, err
+			}
+			return joined, nil
+		}), nil
+	case "substr":
+		return newNativeFnArity("substr", Arity{Min: 1, Max: 2}, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			chars := []rune(s)
+			from, err := toBound(args[0], len(chars), 0)
+			if err != nil {
+				return nil, err
+			}
+			var end interface{}
+			if len(args) > 1 {
+				end = args[1]
+			}
+			to, err := toBound(end, len(chars), len(chars))
+			if err != nil {
+				return nil, err
+			}
+			if from >= to {
+				return "", nil
+			}
+			sub := string(chars[from:to])
+			if err := in.allocate(1 + len(sub)); err != nil {
+				return nil, err
+			}
+			return sub, nil
+		}), nil
+	case "repeat":
+		return newNativeFn("repeat", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+			n, ok := args[0].(float64)
+			if !ok || n < 0 || n != math.Trunc(n) {
+				return nil, nativeErrorf("repeat count must be a whole number of at least 0 but got '%s'", util.ToString(args[0]))
+			}
+			if float64(len(s))*n > maxStringLen {
+				return nil, nativeErrorf("repeated string would be longer than %d bytes", maxStringLen)
+			}
+			// The length alone doesn't bound the count of an empty string
+			if n > math.MaxInt32 {
+				return nil, nativeErrorf("repeat count must be at most %d but got '%s'", math.MaxInt32, util.ToString(n))
+			}
+			if err := in.allocate(1 + len(s)*int(n)); err != nil {
+				return nil, err
+			}
+			return strings.Repeat(s, int(n)), nil
+		}), nil
+	}
+
+	return nil, newErrClass(name, fmt.Sprintf("Undefined property '%s'", name.Lexeme))
+}
+
+// Strings built by repeat stay well below the Go limits.
+const maxStringLen = 1 << 30
+
+// stringFn makes a method taking string args and returning a new string.
+func stringFn(name string, arity int, fn func(args []string) string) *nativeFn {
+	return newNativeFn(name, arity, func(in *Interpreter, args []interface{}) (interface{}, error) {
+		strs := make([]string, len(args))
+		for i, arg := range args {
+			str, err := stringArg(name, arg)
+			if err != nil {
+				return nil, err
+			}
+			strs[i] = str
+		}
+		str := fn(strs)
+		if err := in.allocate(1 + len(str)); err != nil {
+			return nil, err
+		}
+		return str, nil
+	})
+}
+
+func stringArg(name string, arg interface{}) (string, error) {
+	s, ok := arg.(string)
+	if !ok {
+		return "", nativeErrorf("%s takes a string but got '%s'", name, util.ToString(arg))
+	}
+	return s, nil
+}
+
+func newStringList(in *Interpreter, strs []string) (*List, error) {
+	if err := in.allocate(1 + len(strs)); err != nil {
+		return nil, err
+	}
+	elements := make([]interface{}, len(strs))
+	for i, str := range strs {
+		elements[i] = str
+	}
+	return NewList(elements), nil
+}
+
+// strFn converts any value to the string print shows for it.
+var strFn = newNativeFn("str", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+	if s, ok := args[0].(string); ok {
+		return s, nil
+	}
+	str := util.ToString(args[0])
+	if err := in.allocate(1 + len(str)); err != nil {
+		return nil, err
+	}
+	return str, nil
+})
+
+// numFn converts a string written like a number literal, optionally
+// negative, to a number.
+var numFn = newNativeFn("num", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case float64:
+		return v, nil
+	case string:
+		n, err := lex.ParseNumber(v)
+		if err != nil {
+			return nil, nativeErrorf("can't convert %s to a number", repr(v))
+		}
+		return n, nil
+	}
+	return nil, nativeErrorf("can't convert '%s' to a number", util.ToString(args[0]))
+})
@@ -0,0 +1,114 @@
+package eval
+
+import (
+	"errors"
+	d "example/compilers/domain"
+	"example/compilers/util"
+	"fmt"
+)
+
+// ErrThrow carries a value thrown by a throw statement up to the nearest
+// try statement, or out of Interpret when nothing catches it.
+type ErrThrow struct {
+	value interface{}
+	token *d.Token
+}
+
+func (e ErrThrow) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", d.SpanOf(e.token).Start, e.Message(), e.token.Where())
+}
+
+func (e ErrThrow) Message() string {
+	return "Uncaught " + util.ToString(e.value)
+}
+
+func (e ErrThrow) Span() d.Span {
+	return d.SpanOf(e.token)
+}
+
+func (e ErrThrow) Value() interface{} {
+	return e.value
+}
+
+// ErrorObject is the value caught for a runtime error, and the value built
+// by the Error native.
+type ErrorObject struct {
+	message string
+	line    float64
+	stack   *List
+}
+
+func NewErrorObject(message string) *ErrorObject {
+	return &ErrorObject{
+		message: message,
+		stack:   NewList(make([]interface{}, 0)),
+	}
+}
+
+// locate records where the error happened and its stack trace, unless it
+// already knows.
+func (e *ErrorObject) locate(span d.Span, trace []string) {
+	if e.line > 0 || span.Start.Line == 0 {
+		return
+	}
+	e.line = float64(span.Start.Line)
+	e.stack.elements = e.stack.elements[:0]
+	for _, line := range trace {
+		e.stack.elements = append(e.stack.elements, line)
+	}
+}
+
+func (e *ErrorObject) String() string {
+	return "Error: " + e.message
+}
+
+func (e *ErrorObject) Get(name *d.Token) (interface{}, error) {
+	switch name.Lexeme {
+	case "message":
+		return e.message, nil
+	case "line":
+		if e.line == 0 {
+			return nil, nil
+		}
+		return e.line, nil
+	case "stack":
+		return e.stack, nil
+	}
+
+	return nil, newErrClass(name, fmt.Sprintf("Undefined property '%s'", name.Lexeme))
+}
+
+var errorFn = newNativeFn("Error", 1, func(in *Interpreter, args []interface{}) (interface{}, error) {
+	if err := in.allocate(1); err != nil {
+		return nil, err
+	}
+	return NewErrorObject(util.ToString(args[0])), nil
+})
+
+// caught turns an error unwinding through a try statement into the value
+// its catch clause sees: the thrown value itself, or an ErrorObject for a
+// runtime error.
+func (i *Interpreter) caught(err error) interface{} {
+	var thrown ErrThrow
+	if errors.As(err, &thrown) {
+		return thrown.value
+	}
+
+	errObj := NewErrorObject(err.Error())
+	var srcErr interface {
+		Message() string
+		Span() d.Span
+	}
+	if errors.As(err, &srcErr) {
+		errObj.message = srcErr.Message()
+	}
+
+	span := errorSpan(err)
+	var errRuntime ErrRuntime
+	if errors.As(err, &errRuntime) {
+		errObj.locate(span, errRuntime.Trace())
+	} else {
+		errObj.locate(span, formatTrace(i.fileName, i.frames, span))
+	}
+	return errObj
+}
@@ -5,16 +5,14 @@ import (
 	d "example/compilers/domain"
 	"example/compilers/util"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/rs/zerolog/log"
 )
 
-type IScanner interface {
-	Scan() ([]d.Token, error)
-}
-
 type ErrScan struct {
 	errs []error
 }
@@ -30,31 +28,190 @@ func (e ErrScan) Error() string {
 	return sb.String()
 }
 
+func (e ErrScan) Unwrap() []error {
+	return e.errs
+}
+
+// ErrLex is a single scanning error covering the offending source.
+type ErrLex struct {
+	message string
+	hint    string
+	span    d.Span
+}
+
+func (e ErrLex) Error() string {
+	return fmt.Sprintf("%s: %s", e.span.Start, e.message)
+}
+
+func (e ErrLex) Message() string {
+	return e.message
+}
+
+func (e ErrLex) Span() d.Span {
+	return e.span
+}
+
+func (e ErrLex) Hints() []string {
+	if e.hint == "" {
+		return nil
+	}
+	return []string{e.hint}
+}
+
+const readChunkSize = 4096
+
+// Scanner turns source text into tokens. It reads from an io.Reader as
+// tokens are requested, so only the text of the current token has to be held
+// in memory.
 type Scanner struct {
-	source string
-	tokens []*d.Token
+	reader io.Reader
+	// The buffered window of source, starting at byte offset base
+	source  []byte
+	base    int
+	drained bool
+	readErr error
+	// Reused for every read from reader
+	buf []byte
+
+	// Tokens scanned but not yet returned by Next
+	pending []*d.Token
 
 	start   int
 	current int
 	line    int
+	column  int
+
+	// Position of the first character of the token being scanned
+	startPos d.Position
+
+	// Doc comment lines waiting to be attached to the next token
+	docs []string
+
+	// Open "${" interpolations, innermost last
+	interpolations []interpolation
+
+	// Lossless mode, see WithTrivia
+	keepTrivia bool
+	leading    []d.Trivia
+	// Token currently collecting trailing trivia
+	trailing *d.Token
+
+	done bool
+}
+
+type Option func(*Scanner)
+
+// WithTrivia keeps whitespace and comments on the tokens as leading and
+// trailing trivia, so the source can be rebuilt byte for byte with
+// Reconstruct. Trailing trivia runs up to the end of the token's line, any
+// other trivia leads the next token.
+func WithTrivia() Option {
+	return func(s *Scanner) {
+		s.keepTrivia = true
+	}
+}
+
+type interpolation struct {
+	// Unclosed '{' seen inside the embedded expression
+	braces int
+	start  d.Position
 }
 
-func NewScanner(source string) *Scanner {
-	return &Scanner{
-		source:  source,
+func NewScanner(source string, opts ...Option) *Scanner {
+	s := &Scanner{
+		source:  []byte(source),
+		drained: true,
 		start:   0,
 		current: 0,
 		line:    1,
+		column:  1,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
+// NewReaderScanner scans source read incrementally from r.
+func NewReaderScanner(r io.Reader, opts ...Option) *Scanner {
+	s := &Scanner{
+		reader: r,
+		line:   1,
+		column: 1,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Reconstruct rebuilds the source from tokens scanned WithTrivia.
+func Reconstruct(tokens []*d.Token) string {
+	var sb strings.Builder
+	for _, t := range tokens {
+		for _, trivia := range t.LeadingTrivia {
+			sb.WriteString(trivia.Text)
+		}
+		sb.WriteString(t.Lexeme)
+		for _, trivia := range t.TrailingTrivia {
+			sb.WriteString(trivia.Text)
+		}
+	}
+	return sb.String()
+}
+
+// ParseNumber reads text as a number literal, in any format the scanner
+// accepts, with an optional leading '-'. Surrounding whitespace is ignored.
+func ParseNumber(text string) (float64, error) {
+	literal := strings.TrimSpace(text)
+	negative := strings.HasPrefix(literal, "-")
+	if negative {
+		literal = literal[1:]
+	}
+	if literal == "" || !util.IsDigit(rune(literal[0])) {
+		return 0, fmt.Errorf("'%s' is not a number", text)
+	}
+
+	s := NewScanner(literal)
+	t, err := s.Next()
+	if err != nil {
+		return 0, err
+	}
+	end, err := s.Next()
+	if err != nil {
+		return 0, err
+	}
+	// Comments scan as nothing, so the number must also cover all of it
+	if t.Kind != d.NUMBER || end.Kind != d.EOF || t.Span.End.Offset != len(literal) {
+		return 0, fmt.Errorf("'%s' is not a number", text)
+	}
+
+	n := t.Literal.(float64)
+	if negative {
+		n = -n
+	}
+	return n, nil
+}
+
+// Scan scans all remaining tokens, ending with an EOF token. Every scan error
+// is collected into an ErrScan.
 func (s *Scanner) Scan() ([]*d.Token, error) {
+	tokens := make([]*d.Token, 0)
 	errs := make([]error, 0)
-	for !s.isAtEnd() {
-		s.start = s.current
-		err := s.scanToken()
+	for {
+		t, err := s.Next()
 		if err != nil {
+			var errLex ErrLex
+			if !errors.As(err, &errLex) {
+				return nil, err
+			}
 			errs = append(errs, err)
+			continue
+		}
+
+		tokens = append(tokens, t)
+		if t.Kind == d.EOF {
+			break
 		}
 	}
 
@@ -62,11 +219,168 @@ func (s *Scanner) Scan() ([]*d.Token, error) {
 		return nil, ErrScan{errs: errs}
 	}
 
-	s.tokens = append(s.tokens, d.NewToken(d.EOF, "", nil, s.line))
-	return s.tokens, nil
+	return tokens, nil
+}
+
+// Next returns the next token. Scan errors are returned as an ErrLex, after
+// which scanning carries on from the following character. Once the source is
+// exhausted Next keeps returning an EOF token.
+func (s *Scanner) Next() (*d.Token, error) {
+	for len(s.pending) == 0 {
+		if s.isAtEnd() {
+			return s.finish()
+		}
+
+		s.discard()
+		s.start = s.current
+		s.startPos = s.position()
+		err := s.scanToken()
+		if err != nil {
+			return nil, err
+		}
+
+		if s.keepTrivia && len(s.pending) != 0 {
+			err := s.scanTrailingTrivia(s.pending[len(s.pending)-1])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	t := s.pending[0]
+	s.pending = s.pending[1:]
+	return t, nil
+}
+
+func (s *Scanner) finish() (*d.Token, error) {
+	if s.readErr != nil {
+		err := s.readErr
+		s.readErr = nil
+		return nil, err
+	}
+
+	if len(s.interpolations) != 0 {
+		interp := s.interpolations[0]
+		s.interpolations = s.interpolations[1:]
+		return nil, ErrLex{
+			message: "unterminated string interpolation",
+			hint:    "add a closing '}' to end the embedded expression",
+			span:    d.Span{Start: interp.start, End: s.position()},
+		}
+	}
+
+	end := s.position()
+	eof := d.NewTokenAt(d.EOF, "", nil, d.Span{Start: end, End: end})
+	if !s.done {
+		s.attachDocs(eof)
+		eof.LeadingTrivia = s.leading
+		s.leading = nil
+		s.done = true
+	}
+	return eof, nil
+}
+
+// scanTrailingTrivia collects the whitespace and comments following t on
+// the same line.
+func (s *Scanner) scanTrailingTrivia(t *d.Token) error {
+	s.trailing = t
+	defer func() {
+		s.trailing = nil
+	}()
+
+	for !s.isAtEnd() {
+		switch s.peek() {
+		case ' ', '\r', '\t':
+		case '/':
+			if s.peekNext() != '/' && s.peekNext() != '*' {
+				return nil
+			}
+		default:
+			return nil
+		}
+
+		s.start = s.current
+		s.startPos = s.position()
+		err := s.scanToken()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Scanner) addTrivia(kind d.TriviaKind) {
+	if !s.keepTrivia {
+		return
+	}
+
+	text, _ := s.currentSlice()
+	trivia := d.Trivia{Kind: kind, Text: text}
+	if s.trailing != nil {
+		s.trailing.TrailingTrivia = append(s.trailing.TrailingTrivia, trivia)
+	} else {
+		s.leading = append(s.leading, trivia)
+	}
+}
+
+// discard drops source before the current token from the buffered window.
+func (s *Scanner) discard() {
+	if s.reader == nil || s.current < readChunkSize {
+		return
+	}
+
+	// Moving the rest down keeps appends within the window's capacity
+	s.source = s.source[:copy(s.source, s.source[s.current:])]
+	s.base += s.current
+	s.start -= s.current
+	s.current = 0
+}
+
+// fill reads from the reader until the window holds at least n bytes, or
+// the reader is drained.
+func (s *Scanner) fill(n int) {
+	if s.drained || len(s.source) >= n {
+		return
+	}
+	if s.buf == nil {
+		s.buf = make([]byte, readChunkSize)
+	}
+	for !s.drained && len(s.source) < n {
+		read, err := s.reader.Read(s.buf)
+		s.source = append(s.source, s.buf[:read]...)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.readErr = err
+			}
+			s.drained = true
+		}
+	}
+}
+
+// newErrLex creates an error spanning the token scanned so far.
+func (s *Scanner) newErrLex(msg string, hint string) ErrLex {
+	return s.newErrLexAt(s.startPos, msg, hint)
+}
+
+// newErrLexAt creates an error spanning from start to the current position.
+func (s *Scanner) newErrLexAt(start d.Position, msg string, hint string) ErrLex {
+	return ErrLex{
+		message: msg,
+		hint:    hint,
+		span:    d.Span{Start: start, End: s.position()},
+	}
+}
+
+func (s *Scanner) position() d.Position {
+	return d.Position{
+		Line:   s.line,
+		Column: s.column,
+		Offset: s.base + s.current,
+	}
 }
 
 func (s *Scanner) isAtEnd() bool {
+	s.fill(s.current + 1)
 	return s.current >= len(s.source)
 }
 
@@ -83,17 +397,43 @@ func (s *Scanner) scanToken() error {
 		s.addToken(d.RIGHT_PAREN)
 		return nil
 	case '{':
+		if len(s.interpolations) > 0 {
+			s.interpolations[len(s.interpolations)-1].braces++
+		}
 		s.addToken(d.LEFT_BRACE)
 		return nil
 	case '}':
+		if n := len(s.interpolations); n > 0 {
+			if s.interpolations[n-1].braces == 0 {
+				// End of an embedded expression, carry on with the string
+				s.interpolations = s.interpolations[:n-1]
+				return s.scanString()
+			}
+			s.interpolations[n-1].braces--
+		}
 		s.addToken(d.RIGHT_BRACE)
 		return nil
+	case '[':
+		s.addToken(d.LEFT_BRACKET)
+		return nil
+	case ']':
+		s.addToken(d.RIGHT_BRACKET)
+		return nil
 	case ',':
 		s.addToken(d.COMMA)
 		return nil
 	case '.':
+		if s.peek() == '.' && s.peekNext() == '.' {
+			s.advance()
+			s.advance()
+			s.addToken(d.ELLIPSIS)
+			return nil
+		}
 		s.addToken(d.DOT)
 		return nil
+	case ':':
+		s.addToken(d.COLON)
+		return nil
 	case '-':
 		s.addToken(d.MINUS)
 		return nil
@@ -118,6 +458,8 @@ func (s *Scanner) scanToken() error {
 	case '=':
 		if s.matches('=') {
 			s.addToken(d.EQUAL_EQUAL)
+		} else if s.matches('>') {
+			s.addToken(d.ARROW)
 		} else {
 			s.addToken(d.EQUAL)
 		}
@@ -137,76 +479,49 @@ func (s *Scanner) scanToken() error {
 		}
 		return nil
 
-	// Ignore whitespaces
+	// Whitespace is only kept as trivia
 	case ' ', '\r', '\t':
-		s.start++
+		for s.peek() == ' ' || s.peek() == '\r' || s.peek() == '\t' {
+			s.advance()
+		}
+		s.addTrivia(d.TRIVIA_WHITESPACE)
 		return nil
 	case '\n':
-		s.start++
-		s.line++
+		s.addTrivia(d.TRIVIA_NEWLINE)
 		return nil
 
 	// String literals
 	case '"':
-		for s.peek() != '"' && !s.isAtEnd() {
-			if s.peek() == '\n' {
-				s.line++
-			}
-			s.advance()
-		}
-
-		if s.isAtEnd() {
-			return errors.New("unterminated string")
-		}
-
-		s.advance()
-
-		value, err := s.substring(s.start+1, s.current-1)
-		if err != nil {
-			log.Err(err).Msg("Failed to parse string literal")
-			return errors.New("failed to parse string literal")
-		}
-		s.addTokenWithLiteral(d.STRING, value)
-		return nil
+		return s.scanString()
 
 	// Longer lexemes
 	case '/':
 		if s.matches('/') {
+			// '///' starts a doc comment, but '////' is a plain comment
+			isDoc := s.peek() == '/' && s.peekNext() != '/'
 			for s.peek() != '\n' && !s.isAtEnd() {
 				s.advance()
 			}
+			if isDoc {
+				text, _ := s.substring(s.start+3, s.current)
+				s.docs = append(s.docs, strings.TrimPrefix(text, " "))
+				s.addTrivia(d.TRIVIA_DOC_COMMENT)
+			} else {
+				s.addTrivia(d.TRIVIA_LINE_COMMENT)
+			}
+		} else if s.matches('*') {
+			err := s.scanBlockComment()
+			if err != nil {
+				return err
+			}
+			s.addTrivia(d.TRIVIA_BLOCK_COMMENT)
 		} else {
 			s.addToken(d.SLASH)
 		}
 		return nil
 	default:
 		if util.IsDigit(c) {
-			for util.IsDigit(s.peek()) {
-				s.advance()
-			}
-
-			// Fraction
-			if s.peek() == '.' && util.IsDigit(s.peekNext()) {
-				s.advance()
-
-				for util.IsDigit(s.peek()) {
-					s.advance()
-				}
-			}
-
-			text, err := s.currentSlice()
-			if err != nil {
-				log.Err(err).Msg("Failed to parse float literal string")
-				return errors.New("invalid string literal")
-			}
-			value, err := strconv.ParseFloat(text, 64)
-			if err != nil {
-				log.Err(err).Msg("Failed to parse float literal")
-				return errors.New("invalid float literal")
-			}
-
-			s.addTokenWithLiteral(d.NUMBER, value)
-			return nil
+			return s.scanNumber(c)
 		} else if util.IsAlpha(c) {
 			for util.IsAlphaNumeric(s.peek()) {
 				s.advance()
@@ -226,14 +541,258 @@ func (s *Scanner) scanToken() error {
 			}
 			return nil
 		} else {
-			return fmt.Errorf("unexpected character: '%c'", c)
+			return s.newErrLex(fmt.Sprintf("unexpected character: '%c'", c), "")
 		}
 	}
 }
 
+func (s *Scanner) scanNumber(first rune) error {
+	if first == '0' {
+		switch s.peek() {
+		case 'x', 'X':
+			return s.scanRadixNumber(16, "hexadecimal", util.IsHexDigit)
+		case 'b', 'B':
+			return s.scanRadixNumber(2, "binary", util.IsBinaryDigit)
+		case 'o', 'O':
+			return s.scanRadixNumber(8, "octal", util.IsOctalDigit)
+		}
+	}
+
+	err := s.scanDigits(util.IsDigit)
+	if err != nil {
+		return err
+	}
+
+	// Fraction
+	if s.peek() == '.' && util.IsDigit(s.peekNext()) {
+		s.advance()
+		err := s.scanDigits(util.IsDigit)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Exponent
+	if s.peek() == 'e' || s.peek() == 'E' {
+		s.advance()
+		if s.peek() == '+' || s.peek() == '-' {
+			s.advance()
+		}
+		if !util.IsDigit(s.peek()) {
+			return s.newErrLex("exponent has no digits", "write exponents like '1e-9'")
+		}
+		err := s.scanDigits(util.IsDigit)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.checkNumberSuffix("number")
+	if err != nil {
+		return err
+	}
+
+	text, err := s.currentSlice()
+	if err != nil {
+		log.Err(err).Msg("Failed to parse float literal string")
+		return errors.New("invalid string literal")
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(text, "_", ""), 64)
+	if err != nil {
+		return s.newErrLex("number literal out of range", "")
+	}
+
+	s.addTokenWithLiteral(d.NUMBER, value)
+	return nil
+}
+
+// scanRadixNumber scans a '0x', '0b' or '0o' prefixed integer, the leading
+// '0' has already been consumed.
+func (s *Scanner) scanRadixNumber(base int, name string, isDigit func(rune) bool) error {
+	s.advance()
+	if !isDigit(s.peek()) {
+		if util.IsAlphaNumeric(s.peek()) {
+			s.advance()
+			return s.newErrLex(fmt.Sprintf("invalid digit '%c' in %s literal", s.previousChar(), name), "")
+		}
+		return s.newErrLex(fmt.Sprintf("%s literal has no digits", name), "")
+	}
+
+	err := s.scanDigits(isDigit)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkNumberSuffix(name)
+	if err != nil {
+		return err
+	}
+
+	text, err := s.substring(s.start+2, s.current)
+	if err != nil {
+		log.Err(err).Msg("Failed to parse integer literal string")
+		return errors.New("invalid integer literal")
+	}
+	value, err := strconv.ParseUint(strings.ReplaceAll(text, "_", ""), base, 64)
+	if err != nil {
+		return s.newErrLex(fmt.Sprintf("%s literal out of range", name), "")
+	}
+
+	s.addTokenWithLiteral(d.NUMBER, float64(value))
+	return nil
+}
+
+// scanDigits consumes a run of digits, which may be separated by single
+// underscores as in '1_000_000'.
+func (s *Scanner) scanDigits(isDigit func(rune) bool) error {
+	for isDigit(s.peek()) || s.peek() == '_' {
+		if s.advance() == '_' && !isDigit(s.peek()) {
+			return s.newErrLex("'_' must separate digits", "remove the extra '_'")
+		}
+	}
+	return nil
+}
+
+// checkNumberSuffix rejects letters and digits running on from a number,
+// like the '2' in '0b102'.
+func (s *Scanner) checkNumberSuffix(name string) error {
+	if !util.IsAlphaNumeric(s.peek()) {
+		return nil
+	}
+
+	c := s.peek()
+	for util.IsAlphaNumeric(s.peek()) {
+		s.advance()
+	}
+	if util.IsDigit(c) {
+		return s.newErrLex(fmt.Sprintf("invalid digit '%c' in %s literal", c, name), "")
+	}
+	return s.newErrLex(fmt.Sprintf("invalid character '%c' after %s literal", c, name), "")
+}
+
+// scanString scans string contents up to the closing '"', or up to the next
+// "${" which is emitted as an INTERPOLATION token holding the text so far.
+func (s *Scanner) scanString() error {
+	var sb strings.Builder
+	var escErr error
+	for s.peek() != '"' && !s.isAtEnd() {
+		if s.peek() == '$' && s.peekNext() == '{' {
+			s.advance()
+			s.advance()
+			if escErr != nil {
+				return escErr
+			}
+
+			s.interpolations = append(s.interpolations, interpolation{start: s.startPos})
+			s.addTokenWithLiteral(d.INTERPOLATION, sb.String())
+			return nil
+		}
+
+		escStart := s.position()
+		c := s.advance()
+		if c != '\\' {
+			sb.WriteRune(c)
+			continue
+		}
+
+		// Keep going after a bad escape so the rest of the string still scans
+		r, err := s.scanEscape(escStart)
+		if err != nil {
+			if escErr == nil {
+				escErr = err
+			}
+			continue
+		}
+		sb.WriteRune(r)
+	}
+
+	if s.isAtEnd() {
+		return s.newErrLex("unterminated string", "add a closing '\"' to end the string")
+	}
+
+	s.advance()
+
+	if escErr != nil {
+		return escErr
+	}
+
+	s.addTokenWithLiteral(d.STRING, sb.String())
+	return nil
+}
+
+// scanEscape scans the escape sequence following a '\\' in a string.
+func (s *Scanner) scanEscape(start d.Position) (rune, error) {
+	if s.isAtEnd() {
+		return 0, s.newErrLexAt(start, "unterminated escape sequence", "")
+	}
+
+	c := s.advance()
+	switch c {
+	case 'n':
+		return '\n', nil
+	case 't':
+		return '\t', nil
+	case 'r':
+		return '\r', nil
+	case '0':
+		return '\x00', nil
+	case '"', '\\', '$':
+		return c, nil
+	case 'u':
+		if !s.matches('{') {
+			return 0, s.newErrLexAt(start, "invalid unicode escape", "write unicode escapes as '\\u{1F600}'")
+		}
+
+		digits := 0
+		var value rune
+		for util.IsHexDigit(s.peek()) {
+			value = value*16 + util.HexValue(s.advance())
+			digits++
+			if digits > 6 {
+				break
+			}
+		}
+
+		if digits == 0 || digits > 6 || !s.matches('}') {
+			return 0, s.newErrLexAt(start, "invalid unicode escape", "write unicode escapes as '\\u{1F600}' with 1 to 6 hex digits")
+		}
+		if value > utf8.MaxRune || (value >= 0xD800 && value <= 0xDFFF) {
+			return 0, s.newErrLexAt(start, fmt.Sprintf("invalid unicode code point U+%X", value), "")
+		}
+		return value, nil
+	}
+
+	return 0, s.newErrLexAt(start, fmt.Sprintf("invalid escape sequence '\\%c'", c), "valid escapes are \\n \\t \\r \\0 \\\" \\\\ \\$ and \\u{...}")
+}
+
+// scanBlockComment skips a /* ... */ comment, which may contain nested
+// block comments.
+func (s *Scanner) scanBlockComment() error {
+	depth := 1
+	for depth > 0 {
+		if s.isAtEnd() {
+			return s.newErrLex("unterminated block comment", "add a closing '*/' to end the comment")
+		}
+
+		c := s.advance()
+		if c == '/' && s.matches('*') {
+			depth++
+		} else if c == '*' && s.matches('/') {
+			depth--
+		}
+	}
+	return nil
+}
+
 func (s *Scanner) advance() rune {
-	c := s.currentChar()
-	s.current++
+	c, size := s.decodeAt(s.current)
+	s.current += size
+	if c == '\n' {
+		s.line++
+		s.column = 1
+	} else {
+		s.column++
+	}
 	return c
 }
 
@@ -246,7 +805,7 @@ func (s *Scanner) matches(expected rune) bool {
 		return false
 	}
 
-	s.current++
+	s.advance()
 	return true
 }
 
@@ -259,17 +818,28 @@ func (s *Scanner) peek() rune {
 }
 
 func (s *Scanner) peekNext() rune {
-	if s.current+1 >= len(s.source) {
-		return '\x00'
-	}
-	return util.RuneAt(s.source, s.current+1)
+	_, size := s.decodeAt(s.current)
+	c, _ := s.decodeAt(s.current + size)
+	return c
 }
 
 func (s *Scanner) currentChar() rune {
-	if s.current >= len(s.source) {
-		return '\x00'
+	c, _ := s.decodeAt(s.current)
+	return c
+}
+
+func (s *Scanner) previousChar() rune {
+	c, _ := utf8.DecodeLastRune(s.source[:s.current])
+	return c
+}
+
+// decodeAt decodes the UTF-8 rune starting at byte offset i.
+func (s *Scanner) decodeAt(i int) (rune, int) {
+	s.fill(i + utf8.UTFMax)
+	if i >= len(s.source) {
+		return '\x00', 0
 	}
-	return util.RuneAt(s.source, s.current)
+	return utf8.DecodeRune(s.source[i:])
 }
 
 func (s *Scanner) addToken(kind d.TokenType) {
@@ -281,8 +851,21 @@ func (s *Scanner) addTokenWithLiteral(kind d.TokenType, literal interface{}) {
 	if err != nil {
 		log.Err(err).Msg("Failed to parse token literal")
 	}
-	newToken := d.NewToken(kind, text, literal, s.line)
-	s.tokens = append(s.tokens, newToken)
+	span := d.Span{Start: s.startPos, End: s.position()}
+	newToken := d.NewTokenAt(kind, text, literal, span)
+	s.attachDocs(newToken)
+	newToken.LeadingTrivia = s.leading
+	s.leading = nil
+	s.pending = append(s.pending, newToken)
+}
+
+// attachDocs hands any doc comments seen since the last token to t.
+func (s *Scanner) attachDocs(t *d.Token) {
+	if len(s.docs) == 0 {
+		return
+	}
+	t.Doc = strings.Join(s.docs, "\n")
+	s.docs = nil
 }
 
 func (s *Scanner) currentSlice() (string, error) {
@@ -296,5 +879,5 @@ func (s *Scanner) substring(st int, end int) (string, error) {
 	if st < 0 || end > len(s.source) {
 		return "", fmt.Errorf("out of range access: %d %d", st, end)
 	}
-	return s.source[st:end], nil
+	return string(s.source[st:end]), nil
 }
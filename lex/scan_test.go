@@ -1,9 +1,13 @@
 package lex
 
 import (
+	"errors"
 	d "example/compilers/domain"
 	"fmt"
+	"runtime"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -31,24 +35,36 @@ func TestScan(t *testing.T) {
 		{"==", d.EQUAL_EQUAL},
 		{"<", d.LESS},
 		{"<=", d.LESS_EQUAL},
+		{":", d.COLON},
+		{"[", d.LEFT_BRACKET},
+		{"]", d.RIGHT_BRACKET},
+		{"=>", d.ARROW},
+		{"...", d.ELLIPSIS},
 		{">", d.GREATER},
 		{">=", d.GREATER_EQUAL},
 		{"/", d.SLASH},
 		{"i", d.IDENTIFIER},
 		{"and", d.AND},
+		{"break", d.BREAK},
+		{"catch", d.CATCH},
 		{"class", d.CLASS},
+		{"continue", d.CONTINUE},
 		{"else", d.ELSE},
 		{"false", d.FALSE},
+		{"finally", d.FINALLY},
 		{"for", d.FOR},
 		{"fun", d.FUN},
 		{"if", d.IF},
+		{"in", d.IN},
 		{"nil", d.NIL},
 		{"or", d.OR},
 		{"print", d.PRINT},
 		{"return", d.RETURN},
 		{"super", d.SUPER},
 		{"this", d.THIS},
+		{"throw", d.THROW},
 		{"true", d.TRUE},
+		{"try", d.TRY},
 		{"var", d.VAR},
 		{"while", d.WHILE},
 	}
@@ -72,6 +88,10 @@ func TestScan(t *testing.T) {
 		{"\t", d.EOF},
 		{"\n", d.EOF},
 		{"// comment", d.EOF},
+		{"/* comment */", d.EOF},
+		{"/* outer /* nested */ still comment */", d.EOF},
+		{"/**/", d.EOF},
+		{"/// doc comment", d.EOF},
 	}
 
 	for _, c := range wsTestCases {
@@ -97,6 +117,25 @@ func TestScan(t *testing.T) {
 		{"5", d.Token{Kind: d.NUMBER, Literal: 5.0}},
 		{"5.01", d.Token{Kind: d.NUMBER, Literal: 5.01}},
 		{"5.0005", d.Token{Kind: d.NUMBER, Literal: 5.0005}},
+		{"0xFF", d.Token{Kind: d.NUMBER, Literal: 255.0}},
+		{"0Xdead_BEEF", d.Token{Kind: d.NUMBER, Literal: 3735928559.0}},
+		{"0b1010", d.Token{Kind: d.NUMBER, Literal: 10.0}},
+		{"0B1111_0000", d.Token{Kind: d.NUMBER, Literal: 240.0}},
+		{"0o755", d.Token{Kind: d.NUMBER, Literal: 493.0}},
+		{"1e-9", d.Token{Kind: d.NUMBER, Literal: 1e-9}},
+		{"6.02E23", d.Token{Kind: d.NUMBER, Literal: 6.02e23}},
+		{"2e+3", d.Token{Kind: d.NUMBER, Literal: 2000.0}},
+		{"1_000_000", d.Token{Kind: d.NUMBER, Literal: 1000000.0}},
+		{"3.141_592", d.Token{Kind: d.NUMBER, Literal: 3.141592}},
+		{"0", d.Token{Kind: d.NUMBER, Literal: 0.0}},
+		{"007", d.Token{Kind: d.NUMBER, Literal: 7.0}},
+		{`"a\nb"`, d.Token{Kind: d.STRING, Literal: "a\nb"}},
+		{`"\t\r\0"`, d.Token{Kind: d.STRING, Literal: "\t\r\x00"}},
+		{`"say \"hi\" \\o/"`, d.Token{Kind: d.STRING, Literal: `say "hi" \o/`}},
+		{`"\u{1F600} \u{e9}"`, d.Token{Kind: d.STRING, Literal: "😀 é"}},
+		{`"héllo wörld 日本"`, d.Token{Kind: d.STRING, Literal: "héllo wörld 日本"}},
+		{"café", d.Token{Kind: d.IDENTIFIER, Literal: nil}},
+		{"日本語_1", d.Token{Kind: d.IDENTIFIER, Literal: nil}},
 	}
 
 	for _, c := range literalTestCases {
@@ -112,4 +151,340 @@ func TestScan(t *testing.T) {
 			assert.Equal(d.EOF, scannedTokens[1].Kind)
 		})
 	}
+
+	t.Run("Scans token spans", func(t *testing.T) {
+		assert := assert.New(t)
+
+		scannedTokens, err := NewScanner("var ab = 10;\n  print \"hi\";").Scan()
+		assert.NoError(err)
+
+		expectedSpans := []d.Span{
+			{Start: d.Position{Line: 1, Column: 1, Offset: 0}, End: d.Position{Line: 1, Column: 4, Offset: 3}},
+			{Start: d.Position{Line: 1, Column: 5, Offset: 4}, End: d.Position{Line: 1, Column: 7, Offset: 6}},
+			{Start: d.Position{Line: 1, Column: 8, Offset: 7}, End: d.Position{Line: 1, Column: 9, Offset: 8}},
+			{Start: d.Position{Line: 1, Column: 10, Offset: 9}, End: d.Position{Line: 1, Column: 12, Offset: 11}},
+			{Start: d.Position{Line: 1, Column: 12, Offset: 11}, End: d.Position{Line: 1, Column: 13, Offset: 12}},
+			{Start: d.Position{Line: 2, Column: 3, Offset: 15}, End: d.Position{Line: 2, Column: 8, Offset: 20}},
+			{Start: d.Position{Line: 2, Column: 9, Offset: 21}, End: d.Position{Line: 2, Column: 13, Offset: 25}},
+			{Start: d.Position{Line: 2, Column: 13, Offset: 25}, End: d.Position{Line: 2, Column: 14, Offset: 26}},
+			{Start: d.Position{Line: 2, Column: 14, Offset: 26}, End: d.Position{Line: 2, Column: 14, Offset: 26}},
+		}
+
+		assert.Len(scannedTokens, len(expectedSpans))
+		for i, span := range expectedSpans {
+			assert.Equal(span, scannedTokens[i].Span, scannedTokens[i].Lexeme)
+			assert.Equal(span.Start.Line, scannedTokens[i].Line)
+		}
+	})
+
+	t.Run("Counts lines in block comments", func(t *testing.T) {
+		assert := assert.New(t)
+
+		scannedTokens, err := NewScanner("/* one\n /* two\n */\n*/ x").Scan()
+		assert.NoError(err)
+
+		assert.Len(scannedTokens, 2)
+		assert.Equal(d.IDENTIFIER, scannedTokens[0].Kind)
+		assert.Equal(4, scannedTokens[0].Line)
+		assert.Equal(4, scannedTokens[0].Span.Start.Column)
+	})
+
+	blockErrTestCases := []string{"/*", "/* /* */", "/* *"}
+	for _, c := range blockErrTestCases {
+		t.Run(fmt.Sprintf("Errors unterminated block comment: %s", c), func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, err := NewScanner(c).Scan()
+			assert.Error(err)
+		})
+	}
+
+	t.Run("Attaches doc comments to the next token", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "/// Adds numbers.\n///   Indented.\n//// not docs\nfun add() {}\n// plain\nvar x;"
+		scannedTokens, err := NewScanner(source).Scan()
+		assert.NoError(err)
+
+		assert.Equal(d.FUN, scannedTokens[0].Kind)
+		assert.Equal("Adds numbers.\n  Indented.", scannedTokens[0].Doc)
+		for _, tok := range scannedTokens[1:] {
+			assert.Empty(tok.Doc)
+		}
+	})
+
+	stringErrTestCases := []string{
+		`"\q"`,
+		`"\u1F600"`,
+		`"\u{}"`,
+		`"\u{1234567}"`,
+		`"\u{D800}"`,
+		`"\u{110000}"`,
+		`"\u{12"`,
+		`"abc\`,
+	}
+	for _, c := range stringErrTestCases {
+		t.Run(fmt.Sprintf("Errors invalid escape: %s", c), func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, err := NewScanner(c).Scan()
+			assert.Error(err)
+		})
+	}
+
+	t.Run("Spans bad escape only", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := NewScanner(`"ok \q ok"`).Scan()
+		var errLex ErrLex
+		assert.ErrorAs(err, &errLex)
+		assert.Equal(d.Position{Line: 1, Column: 5, Offset: 4}, errLex.Span().Start)
+		assert.Equal(d.Position{Line: 1, Column: 7, Offset: 6}, errLex.Span().End)
+	})
+
+	t.Run("Counts columns in runes and offsets in bytes", func(t *testing.T) {
+		assert := assert.New(t)
+
+		scannedTokens, err := NewScanner(`"日本" é`).Scan()
+		assert.NoError(err)
+
+		assert.Len(scannedTokens, 3)
+		assert.Equal(d.Position{Line: 1, Column: 5, Offset: 8}, scannedTokens[0].Span.End)
+		assert.Equal(d.Position{Line: 1, Column: 6, Offset: 9}, scannedTokens[1].Span.Start)
+		assert.Equal("é", scannedTokens[1].Lexeme)
+	})
+
+	type ScanErrTestCase struct {
+		rawText         string
+		expectedMessage string
+	}
+
+	numberErrTestCases := []ScanErrTestCase{
+		{"0x", "hexadecimal literal has no digits"},
+		{"0b", "binary literal has no digits"},
+		{"0o;", "octal literal has no digits"},
+		{"0xfg", "invalid character 'g' after hexadecimal literal"},
+		{"0b102", "invalid digit '2' in binary literal"},
+		{"0o78", "invalid digit '8' in octal literal"},
+		{"0bz", "invalid digit 'z' in binary literal"},
+		{"1e", "exponent has no digits"},
+		{"1e+", "exponent has no digits"},
+		{"1.5E-x", "exponent has no digits"},
+		{"1__000", "'_' must separate digits"},
+		{"1000_", "'_' must separate digits"},
+		{"1_.5", "'_' must separate digits"},
+		{"12abc", "invalid character 'a' after number literal"},
+		{"0x1_0000_0000_0000_0000", "hexadecimal literal out of range"},
+		{"1e999", "number literal out of range"},
+	}
+
+	for _, c := range numberErrTestCases {
+		t.Run(fmt.Sprintf("Errors malformed number: %s", c.rawText), func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, err := NewScanner(c.rawText).Scan()
+			var errLex ErrLex
+			assert.ErrorAs(err, &errLex)
+			assert.Equal(c.expectedMessage, errLex.Message())
+			assert.Equal(1, errLex.Span().Start.Column)
+		})
+	}
+
+	t.Run("Splits interpolated strings", func(t *testing.T) {
+		assert := assert.New(t)
+
+		scannedTokens, err := NewScanner(`"a ${b} c ${ {} } d ${"e${f}"}"`).Scan()
+		assert.NoError(err)
+
+		expectedKinds := []d.TokenType{
+			d.INTERPOLATION, d.IDENTIFIER,
+			d.INTERPOLATION, d.LEFT_BRACE, d.RIGHT_BRACE,
+			d.INTERPOLATION, d.INTERPOLATION, d.IDENTIFIER, d.STRING,
+			d.STRING, d.EOF,
+		}
+		expectedLiterals := []interface{}{
+			"a ", nil,
+			" c ", nil, nil,
+			" d ", "e", nil, "",
+			"", nil,
+		}
+		assert.Len(scannedTokens, len(expectedKinds))
+		for i := range expectedKinds {
+			assert.Equal(expectedKinds[i], scannedTokens[i].Kind)
+			assert.Equal(expectedLiterals[i], scannedTokens[i].Literal)
+		}
+		assert.Equal("} c ${", scannedTokens[2].Lexeme)
+	})
+
+	interpolationErrTestCases := []string{`"a ${b"`, `"a ${b`, `"a ${ { }"`}
+	for _, c := range interpolationErrTestCases {
+		t.Run(fmt.Sprintf("Errors unterminated interpolation: %s", c), func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, err := NewScanner(c).Scan()
+			assert.Error(err)
+		})
+	}
+
+	t.Run("Scans from a reader", func(t *testing.T) {
+		assert := assert.New(t)
+
+		// Long enough to be read and discarded in several chunks
+		source := strings.Repeat("var café = \"日本 ${1_000}\"; /* c */ print café;\n", 500)
+		expected, err := NewScanner(source).Scan()
+		assert.NoError(err)
+
+		scanner := NewReaderScanner(iotest.HalfReader(strings.NewReader(source)))
+		for _, want := range expected {
+			got, err := scanner.Next()
+			assert.NoError(err)
+			assert.Equal(*want, *got)
+		}
+
+		got, err := scanner.Next()
+		assert.NoError(err)
+		assert.Equal(d.EOF, got.Kind)
+	})
+
+	t.Run("Returns scan errors from Next and carries on", func(t *testing.T) {
+		assert := assert.New(t)
+
+		scanner := NewReaderScanner(strings.NewReader("a @ b"))
+
+		tok, err := scanner.Next()
+		assert.NoError(err)
+		assert.Equal("a", tok.Lexeme)
+
+		_, err = scanner.Next()
+		assert.ErrorAs(err, &ErrLex{})
+
+		tok, err = scanner.Next()
+		assert.NoError(err)
+		assert.Equal("b", tok.Lexeme)
+		assert.Equal(4, tok.Span.Start.Offset)
+	})
+
+	t.Run("Returns reader errors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		readErr := errors.New("connection reset")
+		_, err := NewReaderScanner(iotest.ErrReader(readErr)).Scan()
+		assert.ErrorIs(err, readErr)
+	})
+
+	t.Run("Rebuilds source from trivia", func(t *testing.T) {
+		assert := assert.New(t)
+
+		source := "/// Doc\r\nfun f(a,  b) { // trailing\n\t/* lead /* nested */ */ return a+b;\n}\n\n  print \"x ${ f(1, 2) } y\"; /* end */ // done\n\n"
+
+		tokens, err := NewScanner(source, WithTrivia()).Scan()
+		assert.NoError(err)
+		assert.Equal(source, Reconstruct(tokens))
+
+		tokens, err = NewReaderScanner(iotest.OneByteReader(strings.NewReader(source)), WithTrivia()).Scan()
+		assert.NoError(err)
+		assert.Equal(source, Reconstruct(tokens))
+	})
+
+	t.Run("Splits leading and trailing trivia", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tokens, err := NewScanner("a  // one\n  /* two */ b", WithTrivia()).Scan()
+		assert.NoError(err)
+		assert.Len(tokens, 3)
+
+		assert.Empty(tokens[0].LeadingTrivia)
+		assert.Equal([]d.Trivia{
+			{Kind: d.TRIVIA_WHITESPACE, Text: "  "},
+			{Kind: d.TRIVIA_LINE_COMMENT, Text: "// one"},
+		}, tokens[0].TrailingTrivia)
+
+		assert.Equal([]d.Trivia{
+			{Kind: d.TRIVIA_NEWLINE, Text: "\n"},
+			{Kind: d.TRIVIA_WHITESPACE, Text: "  "},
+			{Kind: d.TRIVIA_BLOCK_COMMENT, Text: "/* two */"},
+			{Kind: d.TRIVIA_WHITESPACE, Text: " "},
+		}, tokens[1].LeadingTrivia)
+		assert.Empty(tokens[1].TrailingTrivia)
+	})
+
+	t.Run("Parses number text", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for text, expected := range map[string]float64{
+			"42":        42,
+			" -1.5 ":    -1.5,
+			"1_000":     1000,
+			"2e3":       2000,
+			"0xff":      255,
+			"-0b101":    -5,
+			"0o17":      15,
+			"123456789": 123456789,
+		} {
+			n, err := ParseNumber(text)
+			assert.NoError(err, text)
+			assert.Equal(expected, n, text)
+		}
+
+		for _, text := range []string{"", "-", "abc", "1 2", "1a", "--1", "+1", ".5", "- 1", "0b102", "1e", "1 // hi", "2 /* x */"} {
+			_, err := ParseNumber(text)
+			assert.Error(err, text)
+		}
+	})
+
+	t.Run("Drops trivia by default", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tokens, err := NewScanner("a // one\n b").Scan()
+		assert.NoError(err)
+		for _, tok := range tokens {
+			assert.Empty(tok.LeadingTrivia)
+			assert.Empty(tok.TrailingTrivia)
+		}
+	})
+}
+
+// BenchmarkScan scans growing sources, from a string and from a reader, and
+// fails if the bytes allocated per byte of source grow with the source.
+func BenchmarkScan(b *testing.B) {
+	chunk := `
+		// Sums the numbers below n
+		fun sum(n) {
+			var total = 0;
+			for (var i = 0; i < n; i = i + 1) total = total + i;
+			return "sum ${n}: ${total}";
+		}
+	`
+	// Tokens cost a few dozen bytes each, whatever the size of the source
+	const maxAllocPerSourceByte = 100
+
+	scanners := map[string]func(source string) *Scanner{
+		"string": func(source string) *Scanner { return NewScanner(source) },
+		"reader": func(source string) *Scanner { return NewReaderScanner(strings.NewReader(source)) },
+	}
+
+	for name, newScanner := range scanners {
+		for _, repeats := range []int{10, 100, 1000} {
+			source := strings.Repeat(chunk, repeats)
+			b.Run(fmt.Sprintf("%s/%dKB", name, len(source)/1024), func(b *testing.B) {
+				b.SetBytes(int64(len(source)))
+				b.ReportAllocs()
+
+				var before, after runtime.MemStats
+				runtime.ReadMemStats(&before)
+				for range b.N {
+					if _, err := newScanner(source).Scan(); err != nil {
+						b.Fatal(err)
+					}
+				}
+				runtime.ReadMemStats(&after)
+
+				perByte := float64(after.TotalAlloc-before.TotalAlloc) / float64(b.N*len(source))
+				b.ReportMetric(perByte, "B/source-B")
+				if perByte > maxAllocPerSourceByte {
+					b.Fatalf("allocated %.0f bytes per byte of source, want at most %d", perByte, maxAllocPerSourceByte)
+				}
+			})
+		}
+	}
 }
@@ -4,9 +4,11 @@ package main
 
 import (
 	"example/compilers/ast"
+	"example/compilers/diag"
 	"example/compilers/eval"
 	"example/compilers/lex"
 	"example/compilers/resolve"
+	"fmt"
 	"os"
 
 	"github.com/rs/zerolog/log"
@@ -26,30 +28,44 @@ func main() {
 
 	// log.Trace().Msg(string(data))
 
-	scanner := lex.NewScanner(string(data))
-	tokens, err := scanner.Scan()
-
-	if err != nil {
-		log.Panic().Err(err).Msg("Failed to scan.")
-	}
+	renderer := diag.NewRenderer(os.Args[1], string(data), diagMode())
 
-	parser := ast.NewParser(tokens)
+	// Scan errors are collected by the parser along with its own
+	scanner := lex.NewScanner(string(data))
+	parser := ast.NewSourceParser(scanner)
 	stmts, err := parser.Parse()
 	if err != nil {
-		log.Panic().Err(err).Msg("Failed to parse.")
+		report(renderer, err)
 	}
 
-	interpreter := eval.NewInterpreter()
+	interpreter := eval.NewInterpreter(eval.WithFileName(os.Args[1]))
 	resolver := resolve.NewResolver(interpreter)
 	err = resolver.Resolve(stmts)
 	if err != nil {
-		log.Panic().Err(err).Msg("Failed to resolve")
+		report(renderer, err)
 	}
 
 	// log.Info().Msg(util.ToString(ast.NewAstPrinter().Print(stmts)))
 
 	err = interpreter.Interpret(stmts)
 	if err != nil {
-		log.Panic().Err(err).Msg("Failed to interpret.")
+		report(renderer, err)
+	}
+}
+
+func report(renderer *diag.Renderer, err error) {
+	fmt.Fprint(os.Stderr, renderer.Render(err))
+	os.Exit(1)
+}
+
+// diagMode colours diagnostics only when stderr is a terminal.
+func diagMode() diag.Mode {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return diag.Plain
+	}
+	info, err := os.Stderr.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return diag.Plain
 	}
+	return diag.Color
 }
@@ -20,7 +20,15 @@ type ErrResolve struct {
 }
 
 func (e ErrResolve) Error() string {
-	return fmt.Sprintf("%s %s", e.message, e.token)
+	return fmt.Sprintf("%s: %s (%s)", d.SpanOf(e.token).Start, e.message, e.token.Where())
+}
+
+func (e ErrResolve) Message() string {
+	return e.message
+}
+
+func (e ErrResolve) Span() d.Span {
+	return d.SpanOf(e.token)
 }
 
 func newErrResolve(t *d.Token, msg string) ErrResolve {
@@ -44,6 +52,10 @@ type Resolver struct {
 	scopes       []scope
 	currentFunc  d.FunctionType
 	currentClass ClassType
+
+	// Labels of the loops enclosing the current statement, innermost last.
+	// Unlabelled loops are nil.
+	loops []*d.Token
 }
 
 func NewResolver(interpreter *eval.Interpreter) *Resolver {
@@ -152,20 +164,21 @@ func (r *Resolver) define(name *d.Token) {
 
 func (r *Resolver) VisitVariableExpr(expr d.VariableExpr) (interface{}, error) {
 	if len(r.scopes) > 0 {
-		if exists, ok := r.getFromScope(expr.Name); !ok || !exists {
+		if defined, ok := r.getFromScope(expr.Name); ok && !defined {
 			return nil, newErrResolve(expr.Name, "can't read local var in own initializer")
 		}
 	}
 
-	r.resolveLocal(expr, expr.Name)
+	r.resolveLocal(expr.Name)
 
 	return nil, nil
 }
 
-func (r *Resolver) resolveLocal(expr d.Expr, name *d.Token) error {
+func (r *Resolver) resolveLocal(name *d.Token) error {
 	for i := len(r.scopes) - 1; i >= 0; i-- {
 		if _, ok := r.scopes[i][name.Lexeme]; ok {
-			r.interpreter.Resolve(expr, len(r.scopes)-1-i)
+			r.interpreter.Resolve(name, len(r.scopes)-1-i)
+			return nil
 		}
 	}
 
@@ -178,7 +191,7 @@ func (r *Resolver) VisitAssignExpr(expr d.AssignExpr) (interface{}, error) {
 		return nil, err
 	}
 
-	err = r.resolveLocal(expr, expr.Name)
+	err = r.resolveLocal(expr.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -201,6 +214,17 @@ func (r *Resolver) VisitFunctionStmt(stmt d.FunctionStmt) error {
 	return nil
 }
 
+func (r *Resolver) VisitLambdaExpr(expr d.LambdaExpr) (interface{}, error) {
+	fn := d.FunctionStmt{
+		Params:   expr.Params,
+		Defaults: expr.Defaults,
+		Rest:     expr.Rest,
+		Body:     expr.Body,
+	}
+	err := r.resolveFunction(fn, d.FUNCTION_TYPE_FN)
+	return nil, err
+}
+
 func (r *Resolver) VisitClassStmt(stmt d.ClassStmt) error {
 	enclosingClass := r.currentClass
 	r.currentClass = ClassType_Class
@@ -262,7 +286,7 @@ func (r *Resolver) VisitSuperExpr(expr d.SuperExpr) (interface{}, error) {
 		return nil, newErrResolve(expr.Keyword, "Can't use 'super' in a class with no superclass.")
 	}
 
-	err := r.resolveLocal(expr, expr.Keyword)
+	err := r.resolveLocal(expr.Keyword)
 	if err != nil {
 		return nil, err
 	}
@@ -275,7 +299,7 @@ func (r *Resolver) VisitThisExpr(expr d.ThisExpr) (interface{}, error) {
 		return nil, newErrResolve(expr.Keyword, "Can't use 'this' outside of a class.")
 	}
 
-	err := r.resolveLocal(expr, expr.Keyword)
+	err := r.resolveLocal(expr.Keyword)
 	if err != nil {
 		return nil, err
 	}
@@ -283,26 +307,46 @@ func (r *Resolver) VisitThisExpr(expr d.ThisExpr) (interface{}, error) {
 	return nil, nil
 }
 
-func (r *Resolver) resolveFunction(f d.FunctionStmt, fnType d.FunctionType) error {
+func (r *Resolver) resolveFunction(fn d.FunctionStmt, fnType d.FunctionType) error {
 	enclosingFnType := r.currentFunc
 	r.currentFunc = fnType
 
+	// Loops don't reach into function bodies
+	enclosingLoops := r.loops
+	r.loops = nil
+
 	r.beginScope()
-	for _, param := range f.Params {
+	for j, param := range fn.Params {
+		// Defaults are evaluated in the call, seeing the params before them
+		if j < len(fn.Defaults) && fn.Defaults[j] != nil {
+			err := r.resolveExpr(fn.Defaults[j])
+			if err != nil {
+				return err
+			}
+		}
+
 		err := r.declare(param)
 		if err != nil {
 			return err
 		}
 		r.define(param)
 	}
+	if fn.Rest != nil {
+		err := r.declare(fn.Rest)
+		if err != nil {
+			return err
+		}
+		r.define(fn.Rest)
+	}
 
-	err := r.Resolve(f.Body)
+	err := r.Resolve(fn.Body)
 	if err != nil {
 		return err
 	}
 
 	r.endScope()
 	r.currentFunc = enclosingFnType
+	r.loops = enclosingLoops
 
 	return nil
 }
@@ -346,18 +390,132 @@ func (r *Resolver) VisitReturnStmt(stmt d.ReturnStmt) error {
 }
 
 func (r *Resolver) VisitWhileStmt(stmt d.WhileStmt) error {
+	if stmt.Label != nil && r.findLoop(stmt.Label) {
+		return newErrResolve(stmt.Label, "Label already used by an enclosing loop.")
+	}
+
 	err := r.resolveExpr(stmt.Condition)
 	if err != nil {
 		return err
 	}
+
+	enclosingLoops := r.loops
+	r.loops = append(r.loops, stmt.Label)
+	err = r.resolveStmt(stmt.Body)
+	r.loops = enclosingLoops
+	if err != nil {
+		return err
+	}
+
+	if stmt.Increment != nil {
+		return r.resolveExpr(stmt.Increment)
+	}
+
+	return nil
+}
+
+func (r *Resolver) VisitForInStmt(stmt d.ForInStmt) error {
+	if stmt.Label != nil && r.findLoop(stmt.Label) {
+		return newErrResolve(stmt.Label, "Label already used by an enclosing loop.")
+	}
+
+	err := r.resolveExpr(stmt.Iterable)
+	if err != nil {
+		return err
+	}
+
+	r.beginScope()
+	for _, v := range stmt.Vars {
+		err = r.declare(v)
+		if err != nil {
+			return err
+		}
+		r.define(v)
+	}
+
+	enclosingLoops := r.loops
+	r.loops = append(r.loops, stmt.Label)
 	err = r.resolveStmt(stmt.Body)
+	r.loops = enclosingLoops
+	if err != nil {
+		return err
+	}
+	r.endScope()
+
+	return nil
+}
+
+func (r *Resolver) VisitThrowStmt(stmt d.ThrowStmt) error {
+	return r.resolveExpr(stmt.Value)
+}
+
+func (r *Resolver) VisitTryStmt(stmt d.TryStmt) error {
+	err := r.resolveBlock(stmt.Body, nil)
 	if err != nil {
 		return err
 	}
+	if stmt.CatchName != nil {
+		err = r.resolveBlock(stmt.Catch, stmt.CatchName)
+		if err != nil {
+			return err
+		}
+	}
+	if stmt.Finally != nil {
+		return r.resolveBlock(stmt.Finally, nil)
+	}
 
 	return nil
 }
 
+// resolveBlock resolves the statements of a try clause in their own scope,
+// declaring the caught value's name first when there is one.
+func (r *Resolver) resolveBlock(stmts []d.Stmt, name *d.Token) error {
+	r.beginScope()
+	if name != nil {
+		err := r.declare(name)
+		if err != nil {
+			return err
+		}
+		r.define(name)
+	}
+
+	err := r.Resolve(stmts)
+	if err != nil {
+		return err
+	}
+	r.endScope()
+
+	return nil
+}
+
+func (r *Resolver) VisitBreakStmt(stmt d.BreakStmt) error {
+	return r.resolveJump(stmt.Keyword, stmt.Label)
+}
+
+func (r *Resolver) VisitContinueStmt(stmt d.ContinueStmt) error {
+	return r.resolveJump(stmt.Keyword, stmt.Label)
+}
+
+func (r *Resolver) resolveJump(keyword *d.Token, label *d.Token) error {
+	if len(r.loops) == 0 {
+		return newErrResolve(keyword, fmt.Sprintf("Can't use '%s' outside of a loop.", keyword.Lexeme))
+	}
+	if label != nil && !r.findLoop(label) {
+		return newErrResolve(label, fmt.Sprintf("No enclosing loop labelled '%s'.", label.Lexeme))
+	}
+
+	return nil
+}
+
+func (r *Resolver) findLoop(label *d.Token) bool {
+	for _, l := range r.loops {
+		if l != nil && l.Lexeme == label.Lexeme {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Resolver) VisitBinaryExpr(expr d.BinaryExpr) (interface{}, error) {
 	err := r.resolveExpr(expr.Left)
 	if err != nil {
@@ -412,12 +570,101 @@ func (r *Resolver) VisitGroupingExpr(expr d.GroupingExpr) (interface{}, error) {
 	return nil, nil
 }
 
+func (r *Resolver) VisitInterpolationExpr(expr d.InterpolationExpr) (interface{}, error) {
+	for _, part := range expr.Parts {
+		err := r.resolveExpr(part)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitListExpr(expr d.ListExpr) (interface{}, error) {
+	for _, element := range expr.Elements {
+		err := r.resolveExpr(element)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitMapExpr(expr d.MapExpr) (interface{}, error) {
+	for i := range expr.Keys {
+		err := r.resolveExpr(expr.Keys[i])
+		if err != nil {
+			return nil, err
+		}
+		err = r.resolveExpr(expr.Values[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitIndexExpr(expr d.IndexExpr) (interface{}, error) {
+	err := r.resolveExpr(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	err = r.resolveExpr(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (r *Resolver) VisitIndexSetExpr(expr d.IndexSetExpr) (interface{}, error) {
+	err := r.resolveExpr(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	err = r.resolveExpr(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+	err = r.resolveExpr(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (r *Resolver) VisitSliceExpr(expr d.SliceExpr) (interface{}, error) {
+	err := r.resolveExpr(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	if expr.Start != nil {
+		err = r.resolveExpr(expr.Start)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if expr.End != nil {
+		err = r.resolveExpr(expr.End)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
 func (r *Resolver) VisitLiteralExpr(expr d.LiteralExpr) (interface{}, error) {
 	return nil, nil
 }
 
 func (r *Resolver) VisitLogicalExpr(expr d.LogicalExpr) (interface{}, error) {
-	err := r.resolveExpr(expr.Right)
+	err := r.resolveExpr(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+	err = r.resolveExpr(expr.Right)
 	if err != nil {
 		return nil, err
 	}
@@ -58,9 +58,13 @@ func TestResolve(t *testing.T) {
 		}},
 		// Own local var in initializer
 		{[]d.Stmt{
-			d.VarStmt{
-				Name:        vToken,
-				Initializer: d.VariableExpr{Name: vToken},
+			d.BlockStmt{
+				Stmts: []d.Stmt{
+					d.VarStmt{
+						Name:        vToken,
+						Initializer: d.VariableExpr{Name: vToken},
+					},
+				},
 			},
 		}},
 		// Multiple declarations
@@ -104,6 +108,59 @@ func TestResolve(t *testing.T) {
 			},
 		},
 		},
+		// Break outside of a loop
+		{[]d.Stmt{
+			d.BreakStmt{Keyword: d.NewToken(d.BREAK, "break", nil, 0)},
+		}},
+		// Continue inside a function inside a loop
+		{[]d.Stmt{
+			d.WhileStmt{
+				Condition: d.LiteralExpr{Value: true},
+				Body: d.FunctionStmt{
+					Name:   vToken,
+					Params: []*d.Token{},
+					Body:   []d.Stmt{d.ContinueStmt{Keyword: d.NewToken(d.CONTINUE, "continue", nil, 0)}},
+				},
+			},
+		}},
+		// Break to an unknown label
+		{[]d.Stmt{
+			d.WhileStmt{
+				Condition: d.LiteralExpr{Value: true},
+				Label:     d.NewToken(d.IDENTIFIER, "outer", nil, 0),
+				Body: d.BreakStmt{
+					Keyword: d.NewToken(d.BREAK, "break", nil, 0),
+					Label:   d.NewToken(d.IDENTIFIER, "inner", nil, 0),
+				},
+			},
+		}},
+		// Loop variable redeclared in the loop's own scope
+		{[]d.Stmt{
+			d.ForInStmt{
+				Vars:     []*d.Token{vToken, vToken},
+				Iterable: d.LiteralExpr{Value: "ab"},
+				Body:     d.BlockStmt{Stmts: []d.Stmt{}},
+			},
+		}},
+		// Rest param named like another param
+		{[]d.Stmt{
+			d.FunctionStmt{
+				Name:     radiusToken,
+				Params:   []*d.Token{vToken},
+				Defaults: []d.Expr{nil},
+				Rest:     vToken,
+				Body:     []d.Stmt{},
+			},
+		}},
+		// Default using 'this' outside of a class
+		{[]d.Stmt{
+			d.FunctionStmt{
+				Name:     radiusToken,
+				Params:   []*d.Token{vToken},
+				Defaults: []d.Expr{d.ThisExpr{Keyword: d.NewToken(d.THIS, "this", nil, 0)}},
+				Body:     []d.Stmt{},
+			},
+		}},
 	}
 
 	for _, c := range testCases {
@@ -114,4 +171,25 @@ func TestResolve(t *testing.T) {
 			assert.Error(err)
 		})
 	}
+
+	t.Run("Resolves outer scope vars", func(t *testing.T) {
+		assert := assert.New(t)
+
+		aToken := d.NewToken(d.IDENTIFIER, "a", nil, 0)
+		stmts := []d.Stmt{
+			d.BlockStmt{Stmts: []d.Stmt{
+				d.VarStmt{Name: aToken, Initializer: d.LiteralExpr{Value: 1}},
+				d.BlockStmt{Stmts: []d.Stmt{
+					d.PrintStmt{Expression: d.LogicalExpr{
+						Left:     d.VariableExpr{Name: aToken},
+						Operator: d.NewToken(d.OR, "or", nil, 0),
+						Right:    d.VariableExpr{Name: aToken},
+					}},
+				}},
+			}},
+		}
+
+		err := NewResolver(eval.NewInterpreter()).Resolve(stmts)
+		assert.NoError(err)
+	})
 }
@@ -4,25 +4,44 @@ import (
 	"errors"
 	d "example/compilers/domain"
 	"fmt"
+	"unicode"
 )
 
-func RuneAt(s string, i int) rune {
-	runeSlice := []rune(s)
-	return runeSlice[i]
-}
-
 func IsDigit(c rune) bool {
 	return c >= '0' && c <= '9'
 }
 
+func IsBinaryDigit(c rune) bool {
+	return c == '0' || c == '1'
+}
+
+func IsOctalDigit(c rune) bool {
+	return c >= '0' && c <= '7'
+}
+
+func IsHexDigit(c rune) bool {
+	return IsDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// HexValue returns the value of a hex digit.
+func HexValue(c rune) rune {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
+
+// IsAlpha reports whether c can start an identifier: any unicode letter or
+// an underscore.
 func IsAlpha(c rune) bool {
-	return (c >= 'a' && c <= 'z') ||
-		(c >= 'A' && c <= 'Z') ||
-		c == '_'
+	return unicode.IsLetter(c) || c == '_'
 }
 
 func IsAlphaNumeric(c rune) bool {
-	return IsAlpha(c) || IsDigit(c)
+	return IsAlpha(c) || unicode.IsDigit(c)
 }
 
 func SprintTokens(ts []*d.Token) string {
@@ -34,8 +53,11 @@ func SprintTokens(ts []*d.Token) string {
 }
 
 func ToString(o interface{}) string {
-	if stringer, ok := o.(interface{ String() }); ok {
-		stringer.String()
+	if o == nil {
+		return "nil"
+	}
+	if stringer, ok := o.(fmt.Stringer); ok {
+		return stringer.String()
 	}
 	return fmt.Sprintf("%v", o)
 }
@@ -140,6 +162,92 @@ func IsEqualExpr(e, o d.Expr) bool {
 			return expected.Keyword.Lexeme == other.Keyword.Lexeme &&
 				expected.Method.Lexeme == other.Method.Lexeme
 		}
+	case d.ListExpr:
+		switch o.(type) {
+		case d.ListExpr:
+			expected, other := e.(d.ListExpr), o.(d.ListExpr)
+			if len(expected.Elements) != len(other.Elements) {
+				return false
+			}
+			for i := range len(expected.Elements) {
+				if !IsEqualExpr(expected.Elements[i], other.Elements[i]) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	case d.MapExpr:
+		switch o.(type) {
+		case d.MapExpr:
+			expected, other := e.(d.MapExpr), o.(d.MapExpr)
+			if len(expected.Keys) != len(other.Keys) {
+				return false
+			}
+			for i := range len(expected.Keys) {
+				if !IsEqualExpr(expected.Keys[i], other.Keys[i]) ||
+					!IsEqualExpr(expected.Values[i], other.Values[i]) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	case d.IndexExpr:
+		switch o.(type) {
+		case d.IndexExpr:
+			expected, other := e.(d.IndexExpr), o.(d.IndexExpr)
+			return IsEqualExpr(expected.Object, other.Object) &&
+				IsEqualExpr(expected.Index, other.Index)
+		}
+		return false
+	case d.IndexSetExpr:
+		switch o.(type) {
+		case d.IndexSetExpr:
+			expected, other := e.(d.IndexSetExpr), o.(d.IndexSetExpr)
+			return IsEqualExpr(expected.Object, other.Object) &&
+				IsEqualExpr(expected.Index, other.Index) &&
+				IsEqualExpr(expected.Value, other.Value)
+		}
+		return false
+	case d.SliceExpr:
+		switch o.(type) {
+		case d.SliceExpr:
+			expected, other := e.(d.SliceExpr), o.(d.SliceExpr)
+			return IsEqualExpr(expected.Object, other.Object) &&
+				IsEqualExpr(expected.Start, other.Start) &&
+				IsEqualExpr(expected.End, other.End)
+		}
+		return false
+	case d.LambdaExpr:
+		switch o.(type) {
+		case d.LambdaExpr:
+			expected, other := e.(d.LambdaExpr), o.(d.LambdaExpr)
+			return IsEqualStmt(
+				d.FunctionStmt{Name: expected.Keyword, Params: expected.Params, Defaults: expected.Defaults, Rest: expected.Rest, Body: expected.Body},
+				d.FunctionStmt{Name: other.Keyword, Params: other.Params, Defaults: other.Defaults, Rest: other.Rest, Body: other.Body},
+			)
+		}
+		return false
+	case d.InterpolationExpr:
+		switch o.(type) {
+		case d.InterpolationExpr:
+			expected, other := e.(d.InterpolationExpr), o.(d.InterpolationExpr)
+			if len(expected.Parts) != len(other.Parts) {
+				return false
+			}
+			for i := range len(expected.Parts) {
+				if !IsEqualExpr(expected.Parts[i], other.Parts[i]) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	}
+
+	if e == nil && o == nil {
+		return true
 	}
 
 	fmt.Printf("UNKNOWN EXPR TYPE %#v %#v\n", e, o)
@@ -200,7 +308,58 @@ func IsEqualStmt(s, o d.Stmt) bool {
 		case d.WhileStmt:
 			expected, other := s.(d.WhileStmt), o.(d.WhileStmt)
 			return IsEqualExpr(expected.Condition, other.Condition) &&
-				IsEqualStmt(expected.Body, other.Body)
+				IsEqualStmt(expected.Body, other.Body) &&
+				IsEqualExpr(expected.Increment, other.Increment) &&
+				isEqualName(expected.Label, other.Label)
+		}
+		return false
+	case d.ForInStmt:
+		switch o.(type) {
+		case d.ForInStmt:
+			expected, other := s.(d.ForInStmt), o.(d.ForInStmt)
+			if len(expected.Vars) != len(other.Vars) {
+				return false
+			}
+			for i := range len(expected.Vars) {
+				if expected.Vars[i].Lexeme != other.Vars[i].Lexeme {
+					return false
+				}
+			}
+			return IsEqualExpr(expected.Iterable, other.Iterable) &&
+				IsEqualStmt(expected.Body, other.Body) &&
+				isEqualName(expected.Label, other.Label)
+		}
+		return false
+	case d.ThrowStmt:
+		switch o.(type) {
+		case d.ThrowStmt:
+			expected, other := s.(d.ThrowStmt), o.(d.ThrowStmt)
+			return IsEqualExpr(expected.Value, other.Value)
+		}
+		return false
+	case d.TryStmt:
+		switch o.(type) {
+		case d.TryStmt:
+			expected, other := s.(d.TryStmt), o.(d.TryStmt)
+			return isEqualStmts(expected.Body, other.Body) &&
+				isEqualName(expected.CatchName, other.CatchName) &&
+				isEqualStmts(expected.Catch, other.Catch) &&
+				(expected.Finally == nil) == (other.Finally == nil) &&
+				isEqualStmts(expected.Finally, other.Finally)
+		}
+		return false
+	case d.BreakStmt:
+		switch o.(type) {
+		case d.BreakStmt:
+			expected, other := s.(d.BreakStmt), o.(d.BreakStmt)
+			return isEqualName(expected.Label, other.Label)
+		}
+		return false
+	case d.ContinueStmt:
+		switch o.(type) {
+		case d.ContinueStmt:
+			expected, other := s.(d.ContinueStmt), o.(d.ContinueStmt)
+			return isEqualName(expected.Label, other.Label)
 		}
 		return false
 	case d.FunctionStmt:
@@ -214,6 +373,12 @@ func IsEqualStmt(s, o d.Stmt) bool {
 				if expected.Params[i].Lexeme != other.Params[i].Lexeme {
 					return false
 				}
+				if !IsEqualExpr(defaultAt(expected.Defaults, i), defaultAt(other.Defaults, i)) {
+					return false
+				}
+			}
+			if !isEqualName(expected.Rest, other.Rest) {
+				return false
 			}
 			if len(expected.Body) != len(other.Body) {
 				return false
@@ -262,6 +427,25 @@ func IsEqualStmt(s, o d.Stmt) bool {
 	return false
 }
 
+func isEqualStmts(s, o []d.Stmt) bool {
+	if len(s) != len(o) {
+		return false
+	}
+	for i := range s {
+		if !IsEqualStmt(s[i], o[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isEqualName(l, o *d.Token) bool {
+	if l == nil || o == nil {
+		return l == o
+	}
+	return l.Lexeme == o.Lexeme
+}
+
 func ToDouble(v interface{}) (float64, error) {
 	switch i := v.(type) {
 	case float64:
@@ -282,3 +466,12 @@ func ToDouble(v interface{}) (float64, error) {
 
 	return 0.0, errors.New("expected floaty value")
 }
+
+// defaultAt gives the default of param i, which is nil if the function
+// has no defaults at all.
+func defaultAt(defaults []d.Expr, i int) d.Expr {
+	if i < len(defaults) {
+		return defaults[i]
+	}
+	return nil
+}